@@ -0,0 +1,245 @@
+package classifier
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+
+	logging "fetch-me-if-you-read-me/logger"
+	"fetch-me-if-you-read-me/watcher"
+
+	"go.uber.org/zap"
+)
+
+const (
+	Human           = "human"
+	MailProxy       = "mail-proxy"
+	PrivacyPrefetch = "privacy-prefetch"
+	Scanner         = "scanner"
+	Unknown         = "unknown"
+
+	// reloadCheckPeriod is how often the rules file is checked for changes.
+	reloadCheckPeriod = 30 * time.Second
+)
+
+var categories = map[string]struct{}{
+	Human:           {},
+	MailProxy:       {},
+	PrivacyPrefetch: {},
+	Scanner:         {},
+	Unknown:         {},
+}
+
+//go:embed rules.json
+var defaultRules []byte
+
+func IsCategory(category string) bool {
+	_, found := categories[category]
+	return found
+}
+
+// RuleDefinition is a rule as written in the rules file. A rule matches the
+// fetches meeting every condition it sets: the user agent matching UserAgent,
+// the client ip within one of Cidrs and each header of Headers present and
+// matching its expression.
+type RuleDefinition struct {
+	Name      string            `json:"name"`
+	Category  string            `json:"category"`
+	UserAgent string            `json:"userAgent,omitempty"`
+	Cidrs     []string          `json:"cidrs,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
+}
+
+type RulesDefinition struct {
+	Rules []*RuleDefinition `json:"rules"`
+}
+
+type rule struct {
+	name      string
+	category  string
+	userAgent *regexp.Regexp
+	networks  []*net.IPNet
+	headers   map[string]*regexp.Regexp
+}
+
+func (r *rule) matches(ip net.IP, header http.Header) bool {
+	if r.userAgent != nil && !r.userAgent.MatchString(header.Get("User-Agent")) {
+		return false
+	}
+
+	if len(r.networks) > 0 {
+		if ip == nil {
+			return false
+		}
+
+		within := false
+		for _, network := range r.networks {
+			if network.Contains(ip) {
+				within = true
+				break
+			}
+		}
+
+		if !within {
+			return false
+		}
+	}
+
+	for name, expression := range r.headers {
+		values, found := header[name]
+		if !found || len(values) == 0 || !expression.MatchString(values[0]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func compile(data []byte) ([]*rule, error) {
+	definition := &RulesDefinition{}
+	if err := json.Unmarshal(data, definition); err != nil {
+
+		return nil, err
+	}
+
+	rules := make([]*rule, 0, len(definition.Rules))
+	for i, ruleDefinition := range definition.Rules {
+		if !IsCategory(ruleDefinition.Category) {
+
+			return nil, fmt.Errorf("rule %d %s has unknown category %s", i+1, ruleDefinition.Name, ruleDefinition.Category)
+		}
+
+		compiled := &rule{
+			name:     ruleDefinition.Name,
+			category: ruleDefinition.Category,
+			headers:  map[string]*regexp.Regexp{},
+		}
+
+		if ruleDefinition.UserAgent != "" {
+			userAgent, err := regexp.Compile(ruleDefinition.UserAgent)
+			if err != nil {
+
+				return nil, fmt.Errorf("rule %d %s user agent: %w", i+1, ruleDefinition.Name, err)
+			}
+
+			compiled.userAgent = userAgent
+		}
+
+		for _, cidr := range ruleDefinition.Cidrs {
+			_, network, err := net.ParseCIDR(cidr)
+			if err != nil {
+
+				return nil, fmt.Errorf("rule %d %s cidr: %w", i+1, ruleDefinition.Name, err)
+			}
+
+			compiled.networks = append(compiled.networks, network)
+		}
+
+		for name, value := range ruleDefinition.Headers {
+			expression, err := regexp.Compile(value)
+			if err != nil {
+
+				return nil, fmt.Errorf("rule %d %s header %s: %w", i+1, ruleDefinition.Name, name, err)
+			}
+
+			compiled.headers[http.CanonicalHeaderKey(name)] = expression
+		}
+
+		if compiled.userAgent == nil && len(compiled.networks) == 0 && len(compiled.headers) == 0 {
+
+			return nil, fmt.Errorf("rule %d %s has no condition", i+1, ruleDefinition.Name)
+		}
+
+		rules = append(rules, compiled)
+	}
+
+	return rules, nil
+}
+
+// Classifier tells the category of a fetch, from the first matching rule or
+// Unknown. Rules read from a file are reloaded when the file changes, a file
+// that fails to load leaves the previous rules in place.
+type Classifier struct {
+	sync.RWMutex
+	logger  *zap.SugaredLogger
+	path    string
+	rules   []*rule
+	watcher *watcher.Watcher
+}
+
+// New loads the rules from path, or the embedded default rules when path is
+// empty.
+func New(path string, logger *logging.Logger) (*Classifier, error) {
+	classifier := &Classifier{
+		logger: logger.Log,
+		path:   path,
+	}
+
+	if path == "" {
+		rules, err := compile(defaultRules)
+		if err != nil {
+
+			return nil, err
+		}
+
+		classifier.rules = rules
+		return classifier, nil
+	}
+
+	if err := classifier.load(); err != nil {
+
+		return nil, err
+	}
+
+	classifier.watcher = watcher.New("classification rules "+path, []string{path}, reloadCheckPeriod, classifier.load, logger.Log)
+	return classifier, nil
+}
+
+// Close stops watching the rules file.
+func (c *Classifier) Close() {
+	if c.watcher != nil {
+		c.watcher.Stop()
+	}
+}
+
+func (c *Classifier) load() error {
+	data, err := os.ReadFile(c.path)
+	if err != nil {
+
+		return err
+	}
+
+	rules, err := compile(data)
+	if err != nil {
+
+		return fmt.Errorf("classification rules %s: %w", c.path, err)
+	}
+
+	c.Lock()
+	c.rules = rules
+	c.Unlock()
+
+	c.logger.Infof("Loaded %d classification rules from %s", len(rules), c.path)
+	return nil
+}
+
+// Classify returns the category of a fetch from ip with header.
+func (c *Classifier) Classify(ip net.IP, header http.Header) string {
+	c.RLock()
+	defer c.RUnlock()
+
+	for _, rule := range c.rules {
+		if rule.matches(ip, header) {
+
+			return rule.category
+		}
+	}
+
+	return Unknown
+}
@@ -0,0 +1,81 @@
+package classifier
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	logging "fetch-me-if-you-read-me/logger"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+var logger = &logging.Logger{
+	Log: zap.NewNop().Sugar(),
+}
+
+func header(userAgent string) http.Header {
+	header := http.Header{}
+	header.Set("User-Agent", userAgent)
+	return header
+}
+
+func TestDefaultRules(t *testing.T) {
+	classifier, err := New("", logger)
+
+	assert.Nil(t, err, "Error has to be nil")
+	assert.NotNil(t, classifier, "Classifier has to be not nil")
+
+	assert.Equal(t, MailProxy, classifier.Classify(net.ParseIP("66.249.84.1"),
+		header("Mozilla/5.0 (Windows NT 5.1; rv:11.0) Gecko Firefox/11.0 (via ggpht.com GoogleImageProxy)")),
+		"Gmail fetches have to be mail-proxy")
+	assert.Equal(t, PrivacyPrefetch, classifier.Classify(net.ParseIP("104.28.1.1"), header("Mozilla/5.0")),
+		"Bare Mozilla fetches have to be privacy-prefetch")
+	assert.Equal(t, Scanner, classifier.Classify(net.ParseIP("40.107.1.1"), header("Mozilla/5.0 (Windows NT 10.0; Win64; x64)")),
+		"Safe Links fetches have to be scanner")
+	assert.Equal(t, Scanner, classifier.Classify(net.ParseIP("10.0.0.1"), header("curl/7.85.0")),
+		"Automated clients have to be scanner")
+	assert.Equal(t, Human, classifier.Classify(net.ParseIP("10.0.0.2"),
+		header("Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko)")),
+		"Mail clients have to be human")
+	assert.Equal(t, Unknown, classifier.Classify(nil, header("")),
+		"Fetches matching no rule have to be unknown")
+}
+
+func TestMalformedRules(t *testing.T) {
+	for _, rules := range []string{
+		`{"rules": [{"name": "r", "category": "robot", "userAgent": "x"}]}`,
+		`{"rules": [{"name": "r", "category": "human"}]}`,
+		`{"rules": [{"name": "r", "category": "human", "userAgent": "("}]}`,
+		`{"rules": [{"name": "r", "category": "human", "cidrs": ["10.0.0.0"]}]}`,
+	} {
+		_, err := compile([]byte(rules))
+		assert.NotNil(t, err, "Error has to be not nil for %s", rules)
+	}
+}
+
+func TestReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	err := os.WriteFile(path, []byte(`{"rules": [{"name": "r", "category": "human", "headers": {"x-test": "^yes$"}}]}`), 0o644)
+	assert.Nil(t, err, "Error has to be nil")
+
+	classifier, err := New(path, logger)
+	assert.Nil(t, err, "Error has to be nil")
+	defer classifier.Close()
+
+	matching := http.Header{}
+	matching.Set("X-Test", "yes")
+	assert.Equal(t, Human, classifier.Classify(nil, matching), "Header rule has to match")
+	assert.Equal(t, Unknown, classifier.Classify(nil, http.Header{}), "Header rule must not match without the header")
+
+	err = os.WriteFile(path, []byte(`{"rules": [{"name": "r", "category": "scanner", "headers": {"x-test": "^yes$"}}]}`), 0o644)
+	assert.Nil(t, err, "Error has to be nil")
+	os.Chtimes(path, time.Now().Add(time.Minute), time.Now().Add(time.Minute))
+	classifier.watcher.Check()
+
+	assert.Equal(t, Scanner, classifier.Classify(nil, matching), "Changed rules have to be reloaded")
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fetch-me-if-you-read-me/model"
+
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var defaultTenant = model.DefaultTenant
+
+type command func(options *Options, model *model.Model, args []string) error
+
+var commands = map[string]command{
+	"rollups-backfill": rollupsBackfill,
+	"api-keys-issue":   apiKeysIssue,
+	"api-keys-list":    apiKeysList,
+	"api-keys-revoke":  apiKeysRevoke,
+	"tenants-create":   tenantsCreate,
+	"tenants-list":     tenantsList,
+	"tenants-quotas":   tenantsQuotas,
+}
+
+func lookupCommand(name string) (command, error) {
+	command, found := commands[name]
+	if !found {
+
+		return nil, fmt.Errorf("unknown command %s", name)
+	}
+
+	return command, nil
+}
+
+func rollupsBackfill(options *Options, model *model.Model, args []string) error {
+	flags := flag.NewFlagSet("rollups-backfill", flag.ContinueOnError)
+	since := flags.String("since", "", "RFC3339 timestamp rollups are rebuilt from, defaults to the oldest recorded fetch")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *since == "" {
+
+		return model.BackfillRollups(nil)
+	}
+
+	sinceTime, err := time.Parse(time.RFC3339, *since)
+	if err != nil {
+		return err
+	}
+
+	return model.BackfillRollups(&sinceTime)
+}
+
+// apiKeysIssue prints the issued key on the standard output, it is the only
+// time the key can be read.
+func apiKeysIssue(options *Options, model *model.Model, args []string) error {
+	flags := flag.NewFlagSet("api-keys-issue", flag.ContinueOnError)
+	name := flags.String("name", "", "name telling who or what the key is issued to")
+	scope := flags.String("scope", "read", "scope granted to the key: read, create or admin")
+	tenant := flags.String("tenant", defaultTenant.String(), "id of the tenant the key acts on behalf of")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *name == "" {
+
+		return fmt.Errorf("api key name must not be empty")
+	}
+
+	tenantUUID, err := uuid.Parse(*tenant)
+	if err != nil {
+		return err
+	}
+
+	apiKey, key, err := model.IssueApiKey(tenantUUID, *name, *scope)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Issued %s api key %s of tenant %s as %s\n", apiKey.Scope, apiKey.Name, apiKey.Tenant, apiKey.Id)
+	fmt.Println(key)
+	return nil
+}
+
+func apiKeysList(options *Options, model *model.Model, args []string) error {
+	apiKeys, err := model.ApiKeys()
+	if err != nil {
+		return err
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "ID\tTENANT\tNAME\tSCOPE\tREVOKED\tLAST USED\tCREATED")
+	for _, apiKey := range apiKeys {
+		lastUsed := "never"
+		if apiKey.LastUsedDate != nil {
+			lastUsed = apiKey.LastUsedDate.Format(time.RFC3339)
+		}
+
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%t\t%s\t%s\n",
+			apiKey.Id, apiKey.Tenant, apiKey.Name, apiKey.Scope, apiKey.Revoked, lastUsed, apiKey.CreateDate.Format(time.RFC3339))
+	}
+
+	return writer.Flush()
+}
+
+func apiKeysRevoke(options *Options, model *model.Model, args []string) error {
+	if len(args) != 1 {
+
+		return fmt.Errorf("api-keys-revoke takes the id of the key to revoke")
+	}
+
+	id, err := uuid.Parse(args[0])
+	if err != nil {
+		return err
+	}
+
+	return model.RevokeApiKey(id)
+}
+
+// quota turns the negative values of quota flags into no quota.
+func quota(value int) *int {
+	if value < 0 {
+
+		return nil
+	}
+
+	return &value
+}
+
+func tenantsCreate(options *Options, model *model.Model, args []string) error {
+	flags := flag.NewFlagSet("tenants-create", flag.ContinueOnError)
+	name := flags.String("name", "", "name of the tenant")
+	maxImages := flags.Int("max-images", -1, "images the tenant can have, negative for no quota")
+	maxCampaigns := flags.Int("max-campaigns", -1, "campaigns the tenant can have, negative for no quota")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *name == "" {
+
+		return fmt.Errorf("tenant name must not be empty")
+	}
+
+	tenant, err := model.CreateTenant(*name, quota(*maxImages), quota(*maxCampaigns))
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(tenant.Id)
+	return nil
+}
+
+func tenantsList(options *Options, model *model.Model, args []string) error {
+	tenants, err := model.Tenants()
+	if err != nil {
+		return err
+	}
+
+	formatQuota := func(used int64, quota *int) string {
+		if quota == nil {
+
+			return fmt.Sprintf("%d", used)
+		}
+
+		return fmt.Sprintf("%d/%d", used, *quota)
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "ID\tNAME\tIMAGES\tCAMPAIGNS\tCREATED")
+	for _, tenant := range tenants {
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\n",
+			tenant.Id, tenant.Name, formatQuota(tenant.Images, tenant.MaxImages),
+			formatQuota(tenant.Campaigns, tenant.MaxCampaigns), tenant.CreateDate.Format(time.RFC3339))
+	}
+
+	return writer.Flush()
+}
+
+// tenantsQuotas replaces both quotas of a tenant, lowering a quota below the
+// current usage only prevents further creations.
+func tenantsQuotas(options *Options, model *model.Model, args []string) error {
+	flags := flag.NewFlagSet("tenants-quotas", flag.ContinueOnError)
+	maxImages := flags.Int("max-images", -1, "images the tenant can have, negative for no quota")
+	maxCampaigns := flags.Int("max-campaigns", -1, "campaigns the tenant can have, negative for no quota")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 1 {
+
+		return fmt.Errorf("tenants-quotas takes the id of the tenant")
+	}
+
+	id, err := uuid.Parse(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	return model.SetTenantQuotas(id, quota(*maxImages), quota(*maxCampaigns))
+}
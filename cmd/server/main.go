@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fetch-me-if-you-read-me/dispatcher"
 	"fetch-me-if-you-read-me/imaginer"
 	"fetch-me-if-you-read-me/model"
 	"fetch-me-if-you-read-me/server"
@@ -28,6 +29,15 @@ func main() {
 		panic(err)
 	}
 
+	var command command
+	if len(options.Command) > 0 {
+		command, err = lookupCommand(options.Command[0])
+		if err != nil {
+
+			panic(err)
+		}
+	}
+
 	imaginer, imaginerErr := imaginer.New(options.Imaginer)
 	if imaginerErr != nil {
 
@@ -43,16 +53,58 @@ func main() {
 	}
 	defer model.Dispose()
 
+	if command != nil {
+		options.Logger.Log.Infof("Running %s command", options.Command[0])
+		if err := command(options, model, options.Command[1:]); err != nil {
+
+			panic(err)
+		}
+
+		return
+	}
+
+	options.Logger.Log.Info("Setup webhooks dispatcher")
+	webhooksDispatcher, webhooksDispatcherErr := dispatcher.New(options.Dispatcher, options.Logger, model)
+	if webhooksDispatcherErr != nil {
+
+		panic(webhooksDispatcherErr)
+	}
+
+	webhooksDispatcher.Start()
+	defer webhooksDispatcher.Stop()
+
 	options.Logger.Log.Info("Setup http server")
 	httpServer, httpServerError := server.New(options.Server, options.Logger, imaginer, model)
 	if httpServerError != nil {
 
 		panic(httpServerError)
 	}
-
-	go httpServer.Listen()
+	defer httpServer.Close()
+
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	go func() {
+		for range reload {
+			options.Logger.Log.Info("Reloading tls certificate due to SIGHUP")
+			httpServer.ReloadCertificate()
+		}
+	}()
+
+	listenErr := make(chan error, 1)
+	go func() {
+		listenErr <- httpServer.Listen()
+	}()
 
 	options.Logger.Log.Infof("Waiting %+v...", is)
-	signal := <-stop
-	options.Logger.Log.Infof("Stopping due to %s", signal.String())
+	select {
+	case signal := <-stop:
+		options.Logger.Log.Infof("Stopping due to %s", signal.String())
+	case err := <-listenErr:
+		options.Logger.Log.Errorf("Stopping due to http server error: %s", err.Error())
+	}
+
+	// Requests are drained first, then the deferred file watchers and
+	// dispatcher stop and model disposal let the pending deliveries and
+	// maintenance runs end before the pool is closed.
+	httpServer.Shutdown()
 }
@@ -2,7 +2,10 @@ package main
 
 import (
 	"errors"
+	"fetch-me-if-you-read-me/deduplicator"
+	"fetch-me-if-you-read-me/dispatcher"
 	"fetch-me-if-you-read-me/imaginer"
+	"fetch-me-if-you-read-me/limiter"
 	"fetch-me-if-you-read-me/model"
 	"fetch-me-if-you-read-me/server"
 
@@ -14,6 +17,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"go.uber.org/zap"
 )
@@ -23,6 +27,8 @@ type Options struct {
 	Logger                   *logging.Logger
 	Imaginer                 *imaginer.ImaginerConfs
 	Server                   *server.ServerConfs
+	Dispatcher               *dispatcher.DispatcherConfs
+	Command                  []string
 }
 
 func parseOptions() (*Options, error) {
@@ -30,6 +36,50 @@ func parseOptions() (*Options, error) {
 	host := flag.String("host", "0.0.0.0", "Host where server will listen")
 	port := flag.String("port", "3000", "Port where server will listen")
 	imageColor := flag.String("image-color", "#00FFFF", "Image color")
+	signedRecipients := flag.Bool("signed-recipients", false, "require per-recipient pixel tokens to be signed")
+	recipientSecret := flag.String("recipient-secret", "", "secret signing per-recipient pixel tokens, taken verbatim")
+	recipientSigningKeys := flag.String("recipient-signing-keys", "", "kid:secret,kid:secret keys signing per-recipient pixel tokens in place of recipient-secret, the first one signing; tokens signed with recipient-secret keep verifying")
+	urlSigningKeys := flag.String("url-signing-keys", "", "kid:secret,kid:secret keys signing pixel urls, the first one signing; unsigned urls are served but not recorded, disabled when empty")
+	trustedProxies := flag.String("trusted-proxies", "", "comma separated cidrs of the proxies whose client ip header is believed, none when empty")
+	clientIPHeader := flag.String("client-ip-header", server.ClientIPHeaderXForwardedFor, "header the trusted proxies set the client ip in, one of X-Forwarded-For, Forwarded or X-Real-Ip")
+	proxyProtocol := flag.Bool("proxy-protocol", false, "expect the PROXY protocol v1 or v2 header on every connection, telling the client address behind tcp load balancers")
+	proxyProtocolUpstreams := flag.String("proxy-protocol-upstreams", "", "comma separated cidrs of the load balancers allowed to connect when the PROXY protocol is expected")
+	headerCapturePreset := flag.String("header-capture-preset", server.HeaderCapturePresetSafe, "fetch headers are stored without credentials (safe) or as the other header capture options tell (none)")
+	headerCaptureAllow := flag.String("header-capture-allow", "", "comma separated fetch headers stored, all of them when empty")
+	headerCaptureDeny := flag.String("header-capture-deny", "", "comma separated fetch headers never stored, on top of the preset ones")
+	headerCaptureRedact := flag.String("header-capture-redact", "", "regular expression whose matches are redacted from stored fetch header values, on top of the preset one")
+	headerCaptureMaxLength := flag.Int("header-capture-max-length", 1024, "bytes kept of each stored fetch header value, 0 keeps them whole")
+	publicBaseUrl := flag.String("public-base-url", "", "public base url of the pixels, derived from each request when empty")
+	legacyCreateRedirect := flag.Bool("legacy-create-redirect", false, "answer image creation with the legacy 307 redirect instead of JSON")
+	requireApiKeys := flag.Bool("require-api-keys", true, "require a bearer api key on management endpoints, the pixel stays public")
+	rateLimitMode := flag.String("rate-limit-mode", limiter.ModeMemory, "rate limit buckets are kept in memory (memory) or shared by replicas through postgresql (postgres)")
+	rateLimitCreate := flag.String("rate-limit-create", "", "token bucket of creations per client ip and per api key as <tokens>/<duration>, disabled when empty")
+	rateLimitFetch := flag.String("rate-limit-fetch", "", "token bucket of recorded fetches per client ip as <tokens>/<duration>, fetches over it are served but not recorded; mail proxies fetch for many readers from few ips, disabled when empty")
+	classificationRules := flag.String("classification-rules", "", "path of the JSON rules classifying fetches into categories, reloaded when it changes; the embedded rules are used when empty")
+	geoipCityDatabase := flag.String("geoip-city-database", "", "path of a MaxMind-format City or Country database locating fetches, reloaded when it changes; disabled when empty")
+	geoipAsnDatabase := flag.String("geoip-asn-database", "", "path of a MaxMind-format ASN database telling the network of fetches, reloaded when it changes; disabled when empty")
+	outOfWindowPolicy := flag.String("out-of-window-policy", server.OutOfWindowRecord, "fetches outside the image activity window are either recorded as out of window (record) or not recorded (skip)")
+	dedupMode := flag.String("dedup-mode", deduplicator.ModeMemory, "fetch fingerprints are kept in memory (memory) or shared by replicas through postgresql (postgres)")
+	dedupWindow := flag.Duration("dedup-window", 0, "fetches of an image by the same client and user agent within this window of a first one are duplicates, disabled when 0")
+	duplicatesPolicy := flag.String("duplicates-policy", server.DuplicatesMark, "duplicate fetches are either recorded as duplicates (mark) or not recorded (skip)")
+	headPolicy := flag.String("head-policy", server.HeadRecord, "HEAD fetches of the pixel are either recorded apart from the opens (record) or not recorded (ignore)")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 30*time.Second, "time given to the requests in flight to complete on shutdown, before their connections are closed")
+	tlsCertificate := flag.String("tls-certificate", "", "PEM certificate chain file served over https, plain http when empty; reloaded when it changes or on SIGHUP")
+	tlsKey := flag.String("tls-key", "", "PEM private key file of the tls certificate")
+	tlsMinVersion := flag.String("tls-min-version", "1.2", "minimum tls version accepted, one of 1.0, 1.1, 1.2 or 1.3")
+	tlsCipherSuites := flag.String("tls-cipher-suites", "", "comma separated cipher suites accepted up to tls 1.2, as named by Go, the Go defaults when empty")
+	readTimeout := flag.Duration("read-timeout", 0, "time allowed to read a whole request, body included, no limit when 0; it ends the /events streams as well, slow headers are bounded by read-header-timeout")
+	readHeaderTimeout := flag.Duration("read-header-timeout", 10*time.Second, "time allowed to read the headers of a request, the read timeout when 0")
+	writeTimeout := flag.Duration("write-timeout", 0, "time allowed to write a response, no limit when 0, as needed by the /events streams")
+	idleTimeout := flag.Duration("idle-timeout", 2*time.Minute, "time a keep-alive connection waits for its next request, the read timeout when 0")
+	maxHeaderBytes := flag.Int("max-header-bytes", 1<<20, "largest request headers size, in bytes")
+	maxConnections := flag.Int("max-connections", 0, "concurrent connections accepted, further ones wait, no limit when 0")
+	maxBodyBytes := flag.Int64("max-body-bytes", 1<<20, "largest JSON request body of the management api, in bytes")
+	metricsPort := flag.String("metrics-port", "", "port serving /metrics apart, without authentication; when empty /metrics is served on the main port with the admin scope")
+	webhooksPollInterval := flag.Duration("webhooks-poll-interval", time.Second, "interval between webhook outbox polls")
+	webhooksTimeout := flag.Duration("webhooks-timeout", 10*time.Second, "timeout of a single webhook delivery attempt")
+	webhooksMaxAttempts := flag.Int("webhooks-max-attempts", 10, "webhook delivery attempts before a delivery is dead-lettered")
+	webhooksBackoff := flag.Duration("webhooks-backoff", 10*time.Second, "delay before the first webhook delivery retry, doubled at each further attempt")
 
 	logEnvironment := flag.String("log-environment", "", "Log environment")
 
@@ -45,12 +95,60 @@ func parseOptions() (*Options, error) {
 	postgresqlThreads := flag.Int("postgresql-threads", 1, "number of thread for postgresql client")
 	postgresqlSchema := flag.String("postgresql-schema", "mafiyrm", "schema where application puts it data model")
 	postgresqlMigrationsTable := flag.String("postgresql-migrations-table", "migrations", "table where migrator puts it data model")
+	postgresqlPartitionsAhead := flag.Int("postgresql-partitions-ahead", 3, "number of monthly images_accessed partitions created ahead of time")
+	postgresqlPartitionsRetention := flag.Int("postgresql-partitions-retention", 0, "number of monthly images_accessed partitions retained, 0 keeps them all")
+	postgresqlPartitionsDrop := flag.Bool("postgresql-partitions-drop", false, "drop partitions older than retention instead of detaching them")
+	postgresqlRollupsInterval := flag.Duration("postgresql-rollups-interval", 5*time.Minute, "interval between hourly rollups refreshes")
 
 	flag.Parse()
 
 	hostEnv, hostEnvSet := os.LookupEnv("HOST")
 	portEnv, portEnvSet := os.LookupEnv("PORT")
 	imageColorEnv, imageColorSet := os.LookupEnv("IMAGE_COLOR")
+	signedRecipientsEnv, signedRecipientsEnvSet := os.LookupEnv("SIGNED_RECIPIENTS")
+	recipientSecretEnv, recipientSecretEnvSet := os.LookupEnv("RECIPIENT_SECRET")
+	recipientSigningKeysEnv, recipientSigningKeysEnvSet := os.LookupEnv("RECIPIENT_SIGNING_KEYS")
+	urlSigningKeysEnv, urlSigningKeysEnvSet := os.LookupEnv("URL_SIGNING_KEYS")
+	requireApiKeysEnv, requireApiKeysEnvSet := os.LookupEnv("REQUIRE_API_KEYS")
+	rateLimitModeEnv, rateLimitModeEnvSet := os.LookupEnv("RATE_LIMIT_MODE")
+	rateLimitCreateEnv, rateLimitCreateEnvSet := os.LookupEnv("RATE_LIMIT_CREATE")
+	rateLimitFetchEnv, rateLimitFetchEnvSet := os.LookupEnv("RATE_LIMIT_FETCH")
+	classificationRulesEnv, classificationRulesEnvSet := os.LookupEnv("CLASSIFICATION_RULES")
+	geoipCityDatabaseEnv, geoipCityDatabaseEnvSet := os.LookupEnv("GEOIP_CITY_DATABASE")
+	geoipAsnDatabaseEnv, geoipAsnDatabaseEnvSet := os.LookupEnv("GEOIP_ASN_DATABASE")
+	outOfWindowPolicyEnv, outOfWindowPolicyEnvSet := os.LookupEnv("OUT_OF_WINDOW_POLICY")
+	trustedProxiesEnv, trustedProxiesEnvSet := os.LookupEnv("TRUSTED_PROXIES")
+	clientIPHeaderEnv, clientIPHeaderEnvSet := os.LookupEnv("CLIENT_IP_HEADER")
+	proxyProtocolEnv, proxyProtocolEnvSet := os.LookupEnv("PROXY_PROTOCOL")
+	proxyProtocolUpstreamsEnv, proxyProtocolUpstreamsEnvSet := os.LookupEnv("PROXY_PROTOCOL_UPSTREAMS")
+	headerCapturePresetEnv, headerCapturePresetEnvSet := os.LookupEnv("HEADER_CAPTURE_PRESET")
+	headerCaptureAllowEnv, headerCaptureAllowEnvSet := os.LookupEnv("HEADER_CAPTURE_ALLOW")
+	headerCaptureDenyEnv, headerCaptureDenyEnvSet := os.LookupEnv("HEADER_CAPTURE_DENY")
+	headerCaptureRedactEnv, headerCaptureRedactEnvSet := os.LookupEnv("HEADER_CAPTURE_REDACT")
+	headerCaptureMaxLengthEnv, headerCaptureMaxLengthEnvSet := os.LookupEnv("HEADER_CAPTURE_MAX_LENGTH")
+	publicBaseUrlEnv, publicBaseUrlEnvSet := os.LookupEnv("PUBLIC_BASE_URL")
+	legacyCreateRedirectEnv, legacyCreateRedirectEnvSet := os.LookupEnv("LEGACY_CREATE_REDIRECT")
+	dedupModeEnv, dedupModeEnvSet := os.LookupEnv("DEDUP_MODE")
+	dedupWindowEnv, dedupWindowEnvSet := os.LookupEnv("DEDUP_WINDOW")
+	duplicatesPolicyEnv, duplicatesPolicyEnvSet := os.LookupEnv("DUPLICATES_POLICY")
+	headPolicyEnv, headPolicyEnvSet := os.LookupEnv("HEAD_POLICY")
+	shutdownTimeoutEnv, shutdownTimeoutEnvSet := os.LookupEnv("SHUTDOWN_TIMEOUT")
+	tlsCertificateEnv, tlsCertificateEnvSet := os.LookupEnv("TLS_CERTIFICATE")
+	tlsKeyEnv, tlsKeyEnvSet := os.LookupEnv("TLS_KEY")
+	tlsMinVersionEnv, tlsMinVersionEnvSet := os.LookupEnv("TLS_MIN_VERSION")
+	tlsCipherSuitesEnv, tlsCipherSuitesEnvSet := os.LookupEnv("TLS_CIPHER_SUITES")
+	readTimeoutEnv, readTimeoutEnvSet := os.LookupEnv("READ_TIMEOUT")
+	readHeaderTimeoutEnv, readHeaderTimeoutEnvSet := os.LookupEnv("READ_HEADER_TIMEOUT")
+	writeTimeoutEnv, writeTimeoutEnvSet := os.LookupEnv("WRITE_TIMEOUT")
+	idleTimeoutEnv, idleTimeoutEnvSet := os.LookupEnv("IDLE_TIMEOUT")
+	maxHeaderBytesEnv, maxHeaderBytesEnvSet := os.LookupEnv("MAX_HEADER_BYTES")
+	maxConnectionsEnv, maxConnectionsEnvSet := os.LookupEnv("MAX_CONNECTIONS")
+	maxBodyBytesEnv, maxBodyBytesEnvSet := os.LookupEnv("MAX_BODY_BYTES")
+	metricsPortEnv, metricsPortEnvSet := os.LookupEnv("METRICS_PORT")
+	webhooksPollIntervalEnv, webhooksPollIntervalEnvSet := os.LookupEnv("WEBHOOKS_POLL_INTERVAL")
+	webhooksTimeoutEnv, webhooksTimeoutEnvSet := os.LookupEnv("WEBHOOKS_TIMEOUT")
+	webhooksMaxAttemptsEnv, webhooksMaxAttemptsEnvSet := os.LookupEnv("WEBHOOKS_MAX_ATTEMPTS")
+	webhooksBackoffEnv, webhooksBackoffEnvSet := os.LookupEnv("WEBHOOKS_BACKOFF")
 
 	logLevelEnv, logLevelEnvSet := os.LookupEnv("LOG_LEVEL")
 	logEnvironmentEnv, logEnvironmentEnvSet := os.LookupEnv("LOG_ENVIRONMENT")
@@ -64,6 +162,10 @@ func parseOptions() (*Options, error) {
 	postgresqlThreadsEnv, postgresqlThreadsEnvSet := os.LookupEnv("POSTGRESQL_THREADS")
 	postgresqlSchemaEnv, postgresqlSchemaEnvSet := os.LookupEnv("POSTGRESQL_SCHEMA")
 	postgresqlMigrationsTableEnv, postgresqlMigrationsTableEnvSet := os.LookupEnv("POSTGRESQL_MIGARTIONS_TABLE")
+	postgresqlPartitionsAheadEnv, postgresqlPartitionsAheadEnvSet := os.LookupEnv("POSTGRESQL_PARTITIONS_AHEAD")
+	postgresqlPartitionsRetentionEnv, postgresqlPartitionsRetentionEnvSet := os.LookupEnv("POSTGRESQL_PARTITIONS_RETENTION")
+	postgresqlPartitionsDropEnv, postgresqlPartitionsDropEnvSet := os.LookupEnv("POSTGRESQL_PARTITIONS_DROP")
+	postgresqlRollupsIntervalEnv, postgresqlRollupsIntervalEnvSet := os.LookupEnv("POSTGRESQL_ROLLUPS_INTERVAL")
 
 	if hostEnvSet {
 		host = &hostEnv
@@ -87,9 +189,332 @@ func parseOptions() (*Options, error) {
 		Color: &rgbaColor,
 	}
 
+	if signedRecipientsEnvSet {
+		signedRecipientsFromEnv, err := strconv.ParseBool(signedRecipientsEnv)
+		if err != nil {
+			return nil, err
+		}
+
+		*signedRecipients = signedRecipientsFromEnv
+	}
+
+	if recipientSecretEnvSet {
+		recipientSecret = &recipientSecretEnv
+	}
+
+	if recipientSigningKeysEnvSet {
+		recipientSigningKeys = &recipientSigningKeysEnv
+	}
+
+	if urlSigningKeysEnvSet {
+		urlSigningKeys = &urlSigningKeysEnv
+	}
+
+	if outOfWindowPolicyEnvSet {
+		outOfWindowPolicy = &outOfWindowPolicyEnv
+	}
+
+	if trustedProxiesEnvSet {
+		trustedProxies = &trustedProxiesEnv
+	}
+
+	if clientIPHeaderEnvSet {
+		clientIPHeader = &clientIPHeaderEnv
+	}
+
+	if proxyProtocolEnvSet {
+		proxyProtocolFromEnv, err := strconv.ParseBool(proxyProtocolEnv)
+		if err != nil {
+			return nil, err
+		}
+
+		*proxyProtocol = proxyProtocolFromEnv
+	}
+
+	if proxyProtocolUpstreamsEnvSet {
+		proxyProtocolUpstreams = &proxyProtocolUpstreamsEnv
+	}
+
+	if headerCapturePresetEnvSet {
+		headerCapturePreset = &headerCapturePresetEnv
+	}
+
+	if headerCaptureAllowEnvSet {
+		headerCaptureAllow = &headerCaptureAllowEnv
+	}
+
+	if headerCaptureDenyEnvSet {
+		headerCaptureDeny = &headerCaptureDenyEnv
+	}
+
+	if headerCaptureRedactEnvSet {
+		headerCaptureRedact = &headerCaptureRedactEnv
+	}
+
+	if headerCaptureMaxLengthEnvSet {
+		headerCaptureMaxLengthFromEnv, err := strconv.Atoi(headerCaptureMaxLengthEnv)
+		if err != nil {
+			return nil, err
+		}
+
+		*headerCaptureMaxLength = headerCaptureMaxLengthFromEnv
+	}
+
+	if publicBaseUrlEnvSet {
+		publicBaseUrl = &publicBaseUrlEnv
+	}
+
+	if legacyCreateRedirectEnvSet {
+		legacyCreateRedirectFromEnv, err := strconv.ParseBool(legacyCreateRedirectEnv)
+		if err != nil {
+			return nil, err
+		}
+
+		*legacyCreateRedirect = legacyCreateRedirectFromEnv
+	}
+
+	if requireApiKeysEnvSet {
+		requireApiKeysFromEnv, err := strconv.ParseBool(requireApiKeysEnv)
+		if err != nil {
+			return nil, err
+		}
+
+		*requireApiKeys = requireApiKeysFromEnv
+	}
+
+	if rateLimitModeEnvSet {
+		rateLimitMode = &rateLimitModeEnv
+	}
+
+	if rateLimitCreateEnvSet {
+		rateLimitCreate = &rateLimitCreateEnv
+	}
+
+	if rateLimitFetchEnvSet {
+		rateLimitFetch = &rateLimitFetchEnv
+	}
+
+	if classificationRulesEnvSet {
+		classificationRules = &classificationRulesEnv
+	}
+
+	if geoipCityDatabaseEnvSet {
+		geoipCityDatabase = &geoipCityDatabaseEnv
+	}
+
+	if geoipAsnDatabaseEnvSet {
+		geoipAsnDatabase = &geoipAsnDatabaseEnv
+	}
+
+	if dedupModeEnvSet {
+		dedupMode = &dedupModeEnv
+	}
+
+	if dedupWindowEnvSet {
+		dedupWindowFromEnv, err := time.ParseDuration(dedupWindowEnv)
+		if err != nil {
+			return nil, err
+		}
+
+		*dedupWindow = dedupWindowFromEnv
+	}
+
+	if duplicatesPolicyEnvSet {
+		duplicatesPolicy = &duplicatesPolicyEnv
+	}
+
+	if headPolicyEnvSet {
+		headPolicy = &headPolicyEnv
+	}
+
+	if shutdownTimeoutEnvSet {
+		shutdownTimeoutFromEnv, err := time.ParseDuration(shutdownTimeoutEnv)
+		if err != nil {
+			return nil, err
+		}
+
+		*shutdownTimeout = shutdownTimeoutFromEnv
+	}
+
+	if tlsCertificateEnvSet {
+		tlsCertificate = &tlsCertificateEnv
+	}
+
+	if tlsKeyEnvSet {
+		tlsKey = &tlsKeyEnv
+	}
+
+	if tlsMinVersionEnvSet {
+		tlsMinVersion = &tlsMinVersionEnv
+	}
+
+	if tlsCipherSuitesEnvSet {
+		tlsCipherSuites = &tlsCipherSuitesEnv
+	}
+
+	if readTimeoutEnvSet {
+		readTimeoutFromEnv, err := time.ParseDuration(readTimeoutEnv)
+		if err != nil {
+			return nil, err
+		}
+
+		*readTimeout = readTimeoutFromEnv
+	}
+
+	if readHeaderTimeoutEnvSet {
+		readHeaderTimeoutFromEnv, err := time.ParseDuration(readHeaderTimeoutEnv)
+		if err != nil {
+			return nil, err
+		}
+
+		*readHeaderTimeout = readHeaderTimeoutFromEnv
+	}
+
+	if writeTimeoutEnvSet {
+		writeTimeoutFromEnv, err := time.ParseDuration(writeTimeoutEnv)
+		if err != nil {
+			return nil, err
+		}
+
+		*writeTimeout = writeTimeoutFromEnv
+	}
+
+	if idleTimeoutEnvSet {
+		idleTimeoutFromEnv, err := time.ParseDuration(idleTimeoutEnv)
+		if err != nil {
+			return nil, err
+		}
+
+		*idleTimeout = idleTimeoutFromEnv
+	}
+
+	if maxHeaderBytesEnvSet {
+		maxHeaderBytesFromEnv, err := strconv.Atoi(maxHeaderBytesEnv)
+		if err != nil {
+			return nil, err
+		}
+
+		*maxHeaderBytes = maxHeaderBytesFromEnv
+	}
+
+	if maxConnectionsEnvSet {
+		maxConnectionsFromEnv, err := strconv.Atoi(maxConnectionsEnv)
+		if err != nil {
+			return nil, err
+		}
+
+		*maxConnections = maxConnectionsFromEnv
+	}
+
+	if maxBodyBytesEnvSet {
+		maxBodyBytesFromEnv, err := strconv.ParseInt(maxBodyBytesEnv, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		*maxBodyBytes = maxBodyBytesFromEnv
+	}
+
+	if metricsPortEnvSet {
+		metricsPort = &metricsPortEnv
+	}
+
+	createRateLimit, err := limiter.ParseRate(*rateLimitCreate)
+	if err != nil {
+		return nil, err
+	}
+
+	fetchRateLimit, err := limiter.ParseRate(*rateLimitFetch)
+	if err != nil {
+		return nil, err
+	}
+
 	serverConf := server.ServerConfs{
-		Host: *host,
-		Port: *port,
+		Host:                   *host,
+		Port:                   *port,
+		SignedRecipients:       *signedRecipients,
+		RecipientSecret:        *recipientSecret,
+		RecipientSigningKeys:   *recipientSigningKeys,
+		OutOfWindowPolicy:      *outOfWindowPolicy,
+		PublicBaseUrl:          *publicBaseUrl,
+		LegacyCreateRedirect:   *legacyCreateRedirect,
+		UrlSigningKeys:         *urlSigningKeys,
+		RequireApiKeys:         *requireApiKeys,
+		RateLimitMode:          *rateLimitMode,
+		CreateRateLimit:        createRateLimit,
+		FetchRateLimit:         fetchRateLimit,
+		ClassificationRules:    *classificationRules,
+		GeoipCityDatabase:      *geoipCityDatabase,
+		GeoipAsnDatabase:       *geoipAsnDatabase,
+		TrustedProxies:         *trustedProxies,
+		ClientIPHeader:         *clientIPHeader,
+		ProxyProtocol:          *proxyProtocol,
+		ProxyProtocolUpstreams: *proxyProtocolUpstreams,
+		HeaderCapturePreset:    *headerCapturePreset,
+		HeaderCaptureAllow:     *headerCaptureAllow,
+		HeaderCaptureDeny:      *headerCaptureDeny,
+		HeaderCaptureRedact:    *headerCaptureRedact,
+		HeaderCaptureMaxLength: *headerCaptureMaxLength,
+		DedupMode:              *dedupMode,
+		DedupWindow:            *dedupWindow,
+		DuplicatesPolicy:       *duplicatesPolicy,
+		HeadPolicy:             *headPolicy,
+		ShutdownTimeout:        *shutdownTimeout,
+		TlsCertificate:         *tlsCertificate,
+		TlsKey:                 *tlsKey,
+		TlsMinVersion:          *tlsMinVersion,
+		TlsCipherSuites:        *tlsCipherSuites,
+		ReadTimeout:            *readTimeout,
+		ReadHeaderTimeout:      *readHeaderTimeout,
+		WriteTimeout:           *writeTimeout,
+		IdleTimeout:            *idleTimeout,
+		MaxHeaderBytes:         *maxHeaderBytes,
+		MaxConnections:         *maxConnections,
+		MaxBodyBytes:           *maxBodyBytes,
+		MetricsPort:            *metricsPort,
+	}
+
+	if webhooksPollIntervalEnvSet {
+		webhooksPollIntervalFromEnv, err := time.ParseDuration(webhooksPollIntervalEnv)
+		if err != nil {
+			return nil, err
+		}
+
+		*webhooksPollInterval = webhooksPollIntervalFromEnv
+	}
+
+	if webhooksTimeoutEnvSet {
+		webhooksTimeoutFromEnv, err := time.ParseDuration(webhooksTimeoutEnv)
+		if err != nil {
+			return nil, err
+		}
+
+		*webhooksTimeout = webhooksTimeoutFromEnv
+	}
+
+	if webhooksMaxAttemptsEnvSet {
+		webhooksMaxAttemptsFromEnv, err := strconv.ParseInt(webhooksMaxAttemptsEnv, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+
+		*webhooksMaxAttempts = int(webhooksMaxAttemptsFromEnv)
+	}
+
+	if webhooksBackoffEnvSet {
+		webhooksBackoffFromEnv, err := time.ParseDuration(webhooksBackoffEnv)
+		if err != nil {
+			return nil, err
+		}
+
+		*webhooksBackoff = webhooksBackoffFromEnv
+	}
+
+	dispatcherConf := dispatcher.DispatcherConfs{
+		PollInterval: *webhooksPollInterval,
+		Timeout:      *webhooksTimeout,
+		MaxAttempts:  *webhooksMaxAttempts,
+		Backoff:      *webhooksBackoff,
 	}
 
 	if logLevelEnvSet {
@@ -166,6 +591,52 @@ func parseOptions() (*Options, error) {
 		postgresqlMigrationsTable = &postgresqlMigrationsTableEnv
 	}
 
+	if postgresqlPartitionsAheadEnvSet {
+		postgresqlPartitionsAheadFromEnv, err := strconv.ParseInt(postgresqlPartitionsAheadEnv, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+
+		*postgresqlPartitionsAhead = int(postgresqlPartitionsAheadFromEnv)
+	}
+
+	if postgresqlPartitionsRetentionEnvSet {
+		postgresqlPartitionsRetentionFromEnv, err := strconv.ParseInt(postgresqlPartitionsRetentionEnv, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+
+		*postgresqlPartitionsRetention = int(postgresqlPartitionsRetentionFromEnv)
+	}
+
+	if postgresqlPartitionsDropEnvSet {
+		postgresqlPartitionsDropFromEnv, err := strconv.ParseBool(postgresqlPartitionsDropEnv)
+		if err != nil {
+			return nil, err
+		}
+
+		*postgresqlPartitionsDrop = postgresqlPartitionsDropFromEnv
+	}
+
+	if postgresqlRollupsIntervalEnvSet {
+		postgresqlRollupsIntervalFromEnv, err := time.ParseDuration(postgresqlRollupsIntervalEnv)
+		if err != nil {
+			return nil, err
+		}
+
+		*postgresqlRollupsInterval = postgresqlRollupsIntervalFromEnv
+	}
+
+	if *postgresqlRollupsInterval <= 0 {
+
+		return nil, errors.New("Postgresql rollups interval must be positive")
+	}
+
+	if *postgresqlPartitionsAhead < 0 || *postgresqlPartitionsRetention < 0 {
+
+		return nil, errors.New("Postgresql partitions ahead and retention must not be negative")
+	}
+
 	if postgresqlAdministrator == nil ||
 		postgresqlAdministratorPassword == nil ||
 		postgresqlHost == nil ||
@@ -200,12 +671,18 @@ func parseOptions() (*Options, error) {
 			ApplicationName:       applicationName,
 			Schema:                postgresqlSchema,
 			MigrationTable:        postgresqlMigrationsTable,
+			PartitionsAhead:       postgresqlPartitionsAhead,
+			PartitionsRetention:   postgresqlPartitionsRetention,
+			PartitionsDrop:        postgresqlPartitionsDrop,
+			RollupsInterval:       postgresqlRollupsInterval,
 		},
 		Logger: &logging.Logger{
 			Log: sugar,
 		},
-		Imaginer: &imaginerConf,
-		Server:   &serverConf,
+		Imaginer:   &imaginerConf,
+		Server:     &serverConf,
+		Dispatcher: &dispatcherConf,
+		Command:    flag.Args(),
 	}, nil
 }
 
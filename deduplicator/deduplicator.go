@@ -0,0 +1,133 @@
+package deduplicator
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	logging "fetch-me-if-you-read-me/logger"
+	"fetch-me-if-you-read-me/model"
+
+	"go.uber.org/zap"
+)
+
+const (
+	ModeMemory   = "memory"
+	ModePostgres = "postgres"
+)
+
+// Deduplicator records fetches by fingerprint, telling whether one with the
+// same fingerprint was recorded within its window. Duplicates do not extend
+// the window, so that a client fetching forever is counted once per window.
+type Deduplicator interface {
+	Seen(fingerprint string) bool
+}
+
+// Fingerprint identifies the fetches of an image for the same recipient, if
+// any, by the same client with the same user agent.
+func Fingerprint(image, recipient, client, userAgent string) string {
+	sum := sha256.Sum256([]byte(image + "\x00" + recipient + "\x00" + client + "\x00" + userAgent))
+	return hex.EncodeToString(sum[:])
+}
+
+// New returns a deduplicator of mode with window, or nil when window is zero.
+func New(mode string, window time.Duration, logger *logging.Logger, model *model.Model) (Deduplicator, error) {
+	if window < 0 {
+
+		return nil, fmt.Errorf("dedup window must not be negative")
+	}
+
+	if window == 0 {
+
+		return nil, nil
+	}
+
+	switch mode {
+	case ModeMemory:
+		return newMemory(window, time.Now), nil
+	case ModePostgres:
+		return newPostgres(window, logger, model), nil
+	default:
+		return nil, fmt.Errorf("dedup mode must be %s or %s", ModeMemory, ModePostgres)
+	}
+}
+
+// memory keeps the fingerprints of a single replica.
+type memory struct {
+	sync.Mutex
+	window    time.Duration
+	now       func() time.Time
+	seen      map[string]time.Time
+	lastSweep time.Time
+}
+
+func newMemory(window time.Duration, now func() time.Time) *memory {
+	return &memory{
+		window:    window,
+		now:       now,
+		seen:      map[string]time.Time{},
+		lastSweep: now(),
+	}
+}
+
+func (m *memory) Seen(fingerprint string) bool {
+	m.Lock()
+	defer m.Unlock()
+
+	now := m.now()
+	m.sweep(now)
+
+	if first, found := m.seen[fingerprint]; found && now.Sub(first) < m.window {
+
+		return true
+	}
+
+	m.seen[fingerprint] = now
+	return false
+}
+
+// sweep forgets the fingerprints whose window is over.
+func (m *memory) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < m.window {
+		return
+	}
+
+	for fingerprint, first := range m.seen {
+		if now.Sub(first) >= m.window {
+			delete(m.seen, fingerprint)
+		}
+	}
+	m.lastSweep = now
+}
+
+// postgres shares the fingerprints among the replicas using the same
+// database. It fails open: a database error counts the fetch as a new one.
+// The fingerprints past their window are pruned from the model maintenance
+// goroutine.
+type postgres struct {
+	logger *zap.SugaredLogger
+	model  *model.Model
+	window time.Duration
+}
+
+func newPostgres(window time.Duration, logger *logging.Logger, model *model.Model) *postgres {
+	model.ScheduleFetchSeenPrune(window)
+
+	return &postgres{
+		logger: logger.Log,
+		model:  model,
+		window: window,
+	}
+}
+
+func (p *postgres) Seen(fingerprint string) bool {
+	duplicate, err := p.model.MarkFetchSeen(fingerprint, p.window)
+	if err != nil {
+		p.logger.Errorf("Marking fetch %s as seen went in error: %s", fingerprint, err.Error())
+		return false
+	}
+
+	return duplicate
+}
@@ -0,0 +1,40 @@
+package deduplicator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemorySeen(t *testing.T) {
+	now := time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC)
+	deduplicator := newMemory(10*time.Second, func() time.Time { return now })
+	fingerprint := Fingerprint("image", "", "127.0.0.1", "Mozilla/5.0")
+
+	assert.False(t, deduplicator.Seen(fingerprint), "First fetch must not be a duplicate")
+	assert.True(t, deduplicator.Seen(fingerprint), "Repeated fetch has to be a duplicate")
+	assert.False(t, deduplicator.Seen(Fingerprint("image", "", "127.0.0.1", "curl/7.85.0")), "Other user agents must not be duplicates")
+	assert.False(t, deduplicator.Seen(Fingerprint("image", "alice", "127.0.0.1", "Mozilla/5.0")), "Other recipients must not be duplicates")
+	assert.False(t, deduplicator.Seen(Fingerprint("image", "bob", "127.0.0.1", "Mozilla/5.0")), "Other recipients must not be duplicates")
+
+	now = now.Add(9 * time.Second)
+	assert.True(t, deduplicator.Seen(fingerprint), "Fetch within the window has to be a duplicate")
+
+	now = now.Add(time.Second)
+	assert.False(t, deduplicator.Seen(fingerprint), "Duplicates must not extend the window")
+	assert.Len(t, deduplicator.seen, 1, "Fingerprints out of their window have to be forgotten")
+}
+
+func TestNew(t *testing.T) {
+	deduplicator, err := New(ModeMemory, 0, nil, nil)
+
+	assert.Nil(t, err, "Error has to be nil")
+	assert.Nil(t, deduplicator, "Deduplicator has to be nil without window")
+
+	_, err = New("disk", time.Second, nil, nil)
+	assert.NotNil(t, err, "Error has to be not nil for unknown modes")
+
+	_, err = New(ModeMemory, -time.Second, nil, nil)
+	assert.NotNil(t, err, "Error has to be not nil for negative windows")
+}
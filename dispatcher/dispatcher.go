@@ -0,0 +1,194 @@
+package dispatcher
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	logging "fetch-me-if-you-read-me/logger"
+	"fetch-me-if-you-read-me/model"
+
+	"go.uber.org/zap"
+)
+
+const (
+	SignatureHeader = "X-Mafiyrm-Signature"
+	DeliveryHeader  = "X-Mafiyrm-Delivery"
+	maxBackoff      = 6 * time.Hour
+)
+
+type DispatcherConfs struct {
+	PollInterval time.Duration
+	Timeout      time.Duration
+	MaxAttempts  int
+	Backoff      time.Duration
+	BatchSize    int
+}
+
+type Dispatcher struct {
+	logger *zap.SugaredLogger
+	model  *model.Model
+	client *http.Client
+
+	pollInterval time.Duration
+	maxAttempts  int
+	backoff      time.Duration
+	batchSize    int
+
+	ticker *time.Ticker
+	done   chan bool
+}
+
+func New(confs *DispatcherConfs, logger *logging.Logger, model *model.Model) (*Dispatcher, error) {
+	if confs.PollInterval <= 0 || confs.Timeout <= 0 || confs.Backoff <= 0 {
+
+		return nil, fmt.Errorf("webhook poll interval, timeout and backoff must be positive")
+	}
+
+	if confs.MaxAttempts < 1 {
+
+		return nil, fmt.Errorf("webhook max attempts must be at least 1")
+	}
+
+	batchSize := confs.BatchSize
+	if batchSize == 0 {
+		batchSize = 16
+	}
+
+	return &Dispatcher{
+		logger: logger.Log,
+		model:  model,
+		client: &http.Client{
+			Timeout: confs.Timeout,
+		},
+		pollInterval: confs.PollInterval,
+		maxAttempts:  confs.MaxAttempts,
+		backoff:      confs.Backoff,
+		batchSize:    batchSize,
+	}, nil
+}
+
+// Sign returns the signature header value for payload sent at timestamp: the
+// hex HMAC-SHA256 of "<timestamp>.<payload>" keyed with the webhook secret.
+func Sign(secret string, timestamp int64, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+
+	return fmt.Sprintf("t=%d,v1=%s", timestamp, hex.EncodeToString(mac.Sum(nil)))
+}
+
+func (d *Dispatcher) Start() {
+	d.ticker = time.NewTicker(d.pollInterval)
+	d.done = make(chan bool)
+	go d.run()
+}
+
+func (d *Dispatcher) Stop() {
+	d.done <- true
+	d.ticker.Stop()
+}
+
+func (d *Dispatcher) run() {
+	for {
+		select {
+		case <-d.done:
+			return
+		case _ = <-d.ticker.C:
+			d.dispatch()
+		}
+	}
+}
+
+func (d *Dispatcher) dispatch() {
+	// Deliveries are leased for the whole worst-case attempt, so that a
+	// delivery still in flight is not picked up again by another replica.
+	deliveries, err := d.model.ClaimWebhookDeliveries(d.batchSize, d.client.Timeout+d.pollInterval)
+	if err != nil {
+		d.logger.Errorf("Claiming webhook deliveries went in error: %s", err.Error())
+		return
+	}
+
+	var wg sync.WaitGroup
+	for _, delivery := range deliveries {
+		wg.Add(1)
+		go func(delivery *model.WebhookDelivery) {
+			defer wg.Done()
+			d.deliver(delivery)
+		}(delivery)
+	}
+	wg.Wait()
+}
+
+func (d *Dispatcher) deliver(delivery *model.WebhookDelivery) {
+	err := d.post(delivery)
+	if err == nil {
+		d.logger.Debugf("Webhook delivery %s to %s done", delivery.Id, delivery.Url)
+		if err := d.model.WebhookDelivered(delivery.Id); err != nil {
+			d.logger.Errorf("Marking webhook delivery %s as delivered went in error: %s", delivery.Id, err.Error())
+		}
+		return
+	}
+
+	var retryIn *time.Duration
+	if delivery.Attempts < d.maxAttempts {
+		backoff := d.backoffFor(delivery.Attempts)
+		retryIn = &backoff
+		d.logger.Warnf("Webhook delivery %s to %s failed (attempt %d), retrying in %s: %s",
+			delivery.Id, delivery.Url, delivery.Attempts, backoff, err.Error())
+	} else {
+		d.logger.Errorf("Webhook delivery %s to %s failed %d times, giving up: %s",
+			delivery.Id, delivery.Url, delivery.Attempts, err.Error())
+	}
+
+	if err := d.model.WebhookFailed(delivery.Id, err.Error(), retryIn); err != nil {
+		d.logger.Errorf("Marking webhook delivery %s as failed went in error: %s", delivery.Id, err.Error())
+	}
+}
+
+func (d *Dispatcher) backoffFor(attempts int) time.Duration {
+	backoff := d.backoff
+	for i := 1; i < attempts && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+
+	if backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+
+	return backoff
+}
+
+func (d *Dispatcher) post(delivery *model.WebhookDelivery) error {
+	payload := []byte(delivery.Payload)
+	request, err := http.NewRequest(http.MethodPost, delivery.Url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(DeliveryHeader, delivery.Id.String())
+	request.Header.Set(SignatureHeader, Sign(delivery.Secret, time.Now().Unix(), payload))
+
+	response, err := d.client.Do(request)
+	if err != nil {
+		return err
+	}
+
+	defer response.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(response.Body, 4096))
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("receiver answered %s", response.Status)
+	}
+
+	return nil
+}
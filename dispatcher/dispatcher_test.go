@@ -0,0 +1,27 @@
+package dispatcher
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSign(t *testing.T) {
+	signature := Sign("secret", 1700000000, []byte(`{"image":"x"}`))
+
+	assert.Equal(t, "t=1700000000,v1=aff1bae0516d753050b0c9cbdaf5f837ee92402a1445a04ba9a135f271ff1447", signature, "Signature has to be stable")
+	assert.NotEqual(t, signature, Sign("other", 1700000000, []byte(`{"image":"x"}`)), "Signature has to depend on the secret")
+	assert.NotEqual(t, signature, Sign("secret", 1700000001, []byte(`{"image":"x"}`)), "Signature has to depend on the timestamp")
+}
+
+func TestBackoff(t *testing.T) {
+	dispatcher := &Dispatcher{
+		backoff: 10 * time.Second,
+	}
+
+	assert.Equal(t, 10*time.Second, dispatcher.backoffFor(1), "First retry has to wait the base backoff")
+	assert.Equal(t, 20*time.Second, dispatcher.backoffFor(2), "Second retry has to wait twice the base backoff")
+	assert.Equal(t, 80*time.Second, dispatcher.backoffFor(4), "Fourth retry has to wait eight times the base backoff")
+	assert.Equal(t, maxBackoff, dispatcher.backoffFor(100), "Backoff has to be capped")
+}
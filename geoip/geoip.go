@@ -0,0 +1,184 @@
+package geoip
+
+import (
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	logging "fetch-me-if-you-read-me/logger"
+	"fetch-me-if-you-read-me/watcher"
+
+	"github.com/oschwald/maxminddb-golang"
+	"go.uber.org/zap"
+)
+
+// reloadCheckPeriod is how often the database files are checked for changes.
+const reloadCheckPeriod = time.Minute
+
+// Location is where an ip address is, as told by the databases, fields they
+// do not tell are left empty.
+type Location struct {
+	Country      string `json:"country,omitempty"`
+	City         string `json:"city,omitempty"`
+	Asn          uint   `json:"asn,omitempty"`
+	Organization string `json:"organization,omitempty"`
+}
+
+// cityRecord reads both the City and the Country databases.
+type cityRecord struct {
+	Country struct {
+		IsoCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+}
+
+type asnRecord struct {
+	Number       uint   `maxminddb:"autonomous_system_number"`
+	Organization string `maxminddb:"autonomous_system_organization"`
+}
+
+// database is a MaxMind-format file, read in memory so that it can be
+// replaced on disk while in use.
+type database struct {
+	sync.RWMutex
+	logger  *zap.SugaredLogger
+	path    string
+	reader  *maxminddb.Reader
+	watcher *watcher.Watcher
+}
+
+func openDatabase(path string, logger *zap.SugaredLogger) (*database, error) {
+	db := &database{
+		logger: logger,
+		path:   path,
+	}
+
+	if err := db.load(); err != nil {
+
+		return nil, err
+	}
+
+	db.watcher = watcher.New("geoip database "+path, []string{path}, reloadCheckPeriod, db.load, logger)
+	return db, nil
+}
+
+func (db *database) load() error {
+	data, err := os.ReadFile(db.path)
+	if err != nil {
+
+		return err
+	}
+
+	reader, err := maxminddb.FromBytes(data)
+	if err != nil {
+
+		return err
+	}
+
+	db.Lock()
+	db.reader = reader
+	db.Unlock()
+
+	db.logger.Infof("Loaded %s geoip database from %s", reader.Metadata.DatabaseType, db.path)
+	return nil
+}
+
+func (db *database) close() {
+	if db != nil {
+		db.watcher.Stop()
+	}
+}
+
+func (db *database) lookup(ip net.IP, record any) bool {
+	db.RLock()
+	defer db.RUnlock()
+
+	if err := db.reader.Lookup(ip, record); err != nil {
+		db.logger.Debugf("Looking up %s in geoip database %s went in error: %s", ip, db.path, err.Error())
+		return false
+	}
+
+	return true
+}
+
+// Enricher locates ip addresses with a City or Country database and an ASN
+// one, both optional. Database files are reloaded when they change, a file
+// that fails to load leaves the previous database in place.
+type Enricher struct {
+	city *database
+	asn  *database
+}
+
+// New opens the databases at cityPath and asnPath, an empty path leaves the
+// database out. It returns a nil enricher, which locates nothing, when both
+// are empty.
+func New(cityPath, asnPath string, logger *logging.Logger) (*Enricher, error) {
+	if cityPath == "" && asnPath == "" {
+
+		return nil, nil
+	}
+
+	enricher := &Enricher{}
+	if cityPath != "" {
+		city, err := openDatabase(cityPath, logger.Log)
+		if err != nil {
+
+			return nil, err
+		}
+
+		enricher.city = city
+	}
+
+	if asnPath != "" {
+		asn, err := openDatabase(asnPath, logger.Log)
+		if err != nil {
+
+			return nil, err
+		}
+
+		enricher.asn = asn
+	}
+
+	return enricher, nil
+}
+
+// Lookup returns the location of ip.
+func (e *Enricher) Lookup(ip net.IP) Location {
+	location := Location{}
+	if e == nil || ip == nil {
+
+		return location
+	}
+
+	if e.city != nil {
+		record := &cityRecord{}
+		if e.city.lookup(ip, record) {
+			location.Country = record.Country.IsoCode
+			location.City = record.City.Names["en"]
+		}
+	}
+
+	if e.asn != nil {
+		record := &asnRecord{}
+		if e.asn.lookup(ip, record) {
+			location.Asn = record.Number
+			location.Organization = record.Organization
+		}
+	}
+
+	return location
+}
+
+// Close stops watching the database files.
+func (e *Enricher) Close() {
+	if e == nil {
+
+		return
+	}
+
+	e.city.close()
+	e.asn.close()
+}
@@ -0,0 +1,142 @@
+package geoip
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	logging "fetch-me-if-you-read-me/logger"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+var logger = &logging.Logger{
+	Log: zap.NewNop().Sugar(),
+}
+
+// encodeString encodes strings shorter than 285 bytes.
+func encodeString(value string) []byte {
+	if len(value) < 29 {
+		return append([]byte{2<<5 | byte(len(value))}, value...)
+	}
+
+	return append([]byte{2<<5 | 29, byte(len(value) - 29)}, value...)
+}
+
+func encodeUint32(value uint32) []byte {
+	return []byte{6<<5 | 4, byte(value >> 24), byte(value >> 16), byte(value >> 8), byte(value)}
+}
+
+func encodeUint16(value uint16) []byte {
+	return []byte{5<<5 | 2, byte(value >> 8), byte(value)}
+}
+
+// encodeMap encodes keys and already encoded values, in turns.
+func encodeMap(pairs ...any) []byte {
+	encoded := []byte{7<<5 | byte(len(pairs)/2)}
+	for i := 0; i < len(pairs); i += 2 {
+		encoded = append(encoded, encodeString(pairs[i].(string))...)
+		encoded = append(encoded, pairs[i+1].([]byte)...)
+	}
+
+	return encoded
+}
+
+// writeDatabase writes an IPv4 MaxMind-format database holding record for the
+// network/8.
+func writeDatabase(t *testing.T, path string, network byte, databaseType string, record []byte) {
+	const nodeCount = 8
+	tree := &bytes.Buffer{}
+	for i := 0; i < nodeCount; i++ {
+		next := uint32(i + 1)
+		if next == nodeCount {
+			next = nodeCount + 16
+		}
+
+		left, right := uint32(nodeCount), uint32(nodeCount)
+		if network&(0x80>>i) == 0 {
+			left = next
+		} else {
+			right = next
+		}
+
+		tree.Write([]byte{byte(left >> 16), byte(left >> 8), byte(left), byte(right >> 16), byte(right >> 8), byte(right)})
+	}
+
+	tree.Write(make([]byte, 16))
+	tree.Write(record)
+	tree.WriteString("\xab\xcd\xefMaxMind.com")
+	tree.Write(encodeMap(
+		"node_count", encodeUint32(nodeCount),
+		"record_size", encodeUint16(24),
+		"ip_version", encodeUint16(4),
+		"database_type", encodeString(databaseType),
+		"binary_format_major_version", encodeUint16(2),
+	))
+
+	assert.Nil(t, os.WriteFile(path, tree.Bytes(), 0o644), "Error has to be nil")
+}
+
+func cityRecordOf(country, city string) []byte {
+	return encodeMap(
+		"country", encodeMap("iso_code", encodeString(country)),
+		"city", encodeMap("names", encodeMap("en", encodeString(city))),
+	)
+}
+
+func TestLookup(t *testing.T) {
+	directory := t.TempDir()
+	cityPath := filepath.Join(directory, "city.mmdb")
+	asnPath := filepath.Join(directory, "asn.mmdb")
+	writeDatabase(t, cityPath, 81, "GeoLite2-City", cityRecordOf("IT", "Milan"))
+	writeDatabase(t, asnPath, 81, "GeoLite2-ASN", encodeMap(
+		"autonomous_system_number", encodeUint32(3269),
+		"autonomous_system_organization", encodeString("Telecom Italia"),
+	))
+
+	enricher, err := New(cityPath, asnPath, logger)
+	assert.Nil(t, err, "Error has to be nil")
+	defer enricher.Close()
+
+	assert.Equal(t, Location{Country: "IT", City: "Milan", Asn: 3269, Organization: "Telecom Italia"},
+		enricher.Lookup(net.ParseIP("81.2.3.4")), "Location has to be read from both databases")
+	assert.Equal(t, Location{}, enricher.Lookup(net.ParseIP("82.2.3.4")), "Unknown networks have no location")
+	assert.Equal(t, Location{}, enricher.Lookup(nil), "Missing ips have no location")
+}
+
+func TestDisabled(t *testing.T) {
+	enricher, err := New("", "", logger)
+
+	assert.Nil(t, err, "Error has to be nil")
+	assert.Nil(t, enricher, "Enricher has to be nil without databases")
+	assert.Equal(t, Location{}, enricher.Lookup(net.ParseIP("81.2.3.4")), "Nil enricher has to locate nothing")
+
+	_, err = New(filepath.Join(t.TempDir(), "missing.mmdb"), "", logger)
+	assert.NotNil(t, err, "Error has to be not nil for missing databases")
+}
+
+func TestReload(t *testing.T) {
+	cityPath := filepath.Join(t.TempDir(), "city.mmdb")
+	writeDatabase(t, cityPath, 81, "GeoLite2-City", cityRecordOf("IT", "Milan"))
+
+	enricher, err := New(cityPath, "", logger)
+	assert.Nil(t, err, "Error has to be nil")
+	defer enricher.Close()
+	assert.Equal(t, "IT", enricher.Lookup(net.ParseIP("81.2.3.4")).Country, "Country has to be read")
+
+	writeDatabase(t, cityPath, 81, "GeoLite2-City", cityRecordOf("FR", "Paris"))
+	os.Chtimes(cityPath, time.Now().Add(time.Minute), time.Now().Add(time.Minute))
+	enricher.city.watcher.Check()
+
+	assert.Equal(t, "FR", enricher.Lookup(net.ParseIP("81.2.3.4")).Country, "Changed database has to be reloaded")
+
+	os.WriteFile(cityPath, []byte("broken"), 0o644)
+	os.Chtimes(cityPath, time.Now().Add(2*time.Minute), time.Now().Add(2*time.Minute))
+	enricher.city.watcher.Check()
+
+	assert.Equal(t, "FR", enricher.Lookup(net.ParseIP("81.2.3.4")).Country, "Broken database must leave the previous one")
+}
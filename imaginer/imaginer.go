@@ -51,6 +51,10 @@ func New(conf *ImaginerConfs) (*Imaginer, error) {
 	}, nil
 }
 
+func (imager *Imaginer) Size() (uint, uint) {
+	return imager.width, imager.height
+}
+
 func (imager *Imaginer) MakeImage() *Image {
 	upLeft := image.Point{0, 0}
 	lowRight := image.Point{int(imager.width), int(imager.height)}
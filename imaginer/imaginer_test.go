@@ -42,3 +42,17 @@ func TestCreateImageWithConf(t *testing.T) {
 	assert.Equal(t, image.Image.Rect.Dx(), 10, "Image has to be 10 px width")
 	assert.Equal(t, image.Image.Rect.Dy(), 5, "Image has to be 5 px height")
 }
+
+func TestImageSize(t *testing.T) {
+	imager, err := New(&ImaginerConfs{
+		Width:  10,
+		Height: 5,
+	})
+
+	assert.NotNil(t, imager, "New client has to be not nil")
+	assert.Nil(t, err, "Error has to be nil")
+
+	width, height := imager.Size()
+	assert.Equal(t, width, uint(10), "Size width has to be 10 px")
+	assert.Equal(t, height, uint(5), "Size height has to be 5 px")
+}
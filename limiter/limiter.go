@@ -0,0 +1,186 @@
+package limiter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	logging "fetch-me-if-you-read-me/logger"
+	"fetch-me-if-you-read-me/model"
+
+	"go.uber.org/zap"
+)
+
+const (
+	ModeMemory   = "memory"
+	ModePostgres = "postgres"
+)
+
+// Rate is a token bucket holding up to Tokens tokens, refilled with Tokens
+// tokens every Per.
+type Rate struct {
+	Tokens int
+	Per    time.Duration
+}
+
+// ParseRate parses "<tokens>/<duration>", such as "60/1m". An empty value
+// means no limit and gives a nil rate.
+func ParseRate(value string) (*Rate, error) {
+	if strings.TrimSpace(value) == "" {
+
+		return nil, nil
+	}
+
+	tokens, per, found := strings.Cut(value, "/")
+	if !found {
+
+		return nil, fmt.Errorf("rate %s must be formatted as <tokens>/<duration>", value)
+	}
+
+	tokensCount, err := strconv.Atoi(strings.TrimSpace(tokens))
+	if err != nil || tokensCount < 1 {
+
+		return nil, fmt.Errorf("rate %s must have a positive number of tokens", value)
+	}
+
+	perDuration, err := time.ParseDuration(strings.TrimSpace(per))
+	if err != nil || perDuration <= 0 {
+
+		return nil, fmt.Errorf("rate %s must have a positive duration", value)
+	}
+
+	return &Rate{
+		Tokens: tokensCount,
+		Per:    perDuration,
+	}, nil
+}
+
+func (rate *Rate) perSecond() float64 {
+	return float64(rate.Tokens) / rate.Per.Seconds()
+}
+
+// Limiter takes tokens from the bucket of each key, telling whether one was
+// available or how long to wait for the next one.
+type Limiter interface {
+	Take(key string) (bool, time.Duration)
+}
+
+// New returns a limiter of mode applying rate, or nil when rate is nil. Keys
+// are namespaced by name, so that limiters can share the postgres buckets.
+func New(name, mode string, rate *Rate, logger *logging.Logger, model *model.Model) (Limiter, error) {
+	if rate == nil {
+
+		return nil, nil
+	}
+
+	switch mode {
+	case ModeMemory:
+		return newMemory(rate, time.Now), nil
+	case ModePostgres:
+		return newPostgres(name, rate, logger, model), nil
+	default:
+		return nil, fmt.Errorf("rate limit mode must be %s or %s", ModeMemory, ModePostgres)
+	}
+}
+
+type bucket struct {
+	tokens float64
+	refill time.Time
+}
+
+// memory keeps the buckets of a single replica.
+type memory struct {
+	sync.Mutex
+	rate      *Rate
+	now       func() time.Time
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+func newMemory(rate *Rate, now func() time.Time) *memory {
+	return &memory{
+		rate:      rate,
+		now:       now,
+		buckets:   map[string]*bucket{},
+		lastSweep: now(),
+	}
+}
+
+func (m *memory) Take(key string) (bool, time.Duration) {
+	m.Lock()
+	defer m.Unlock()
+
+	now := m.now()
+	m.sweep(now)
+
+	capacity := float64(m.rate.Tokens)
+	current, found := m.buckets[key]
+	if !found {
+		current = &bucket{
+			tokens: capacity,
+			refill: now,
+		}
+		m.buckets[key] = current
+	}
+
+	current.tokens += now.Sub(current.refill).Seconds() * m.rate.perSecond()
+	if current.tokens > capacity {
+		current.tokens = capacity
+	}
+	current.refill = now
+
+	if current.tokens >= 1 {
+		current.tokens--
+		return true, 0
+	}
+
+	return false, time.Duration((1 - current.tokens) / m.rate.perSecond() * float64(time.Second))
+}
+
+// sweep forgets the buckets left untouched long enough to be full again.
+func (m *memory) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < m.rate.Per {
+		return
+	}
+
+	for key, current := range m.buckets {
+		if now.Sub(current.refill) >= m.rate.Per {
+			delete(m.buckets, key)
+		}
+	}
+	m.lastSweep = now
+}
+
+// postgres shares the buckets among the replicas using the same database.
+// Takes fail open: a database error lets the request through. The idle
+// buckets are pruned from the model maintenance goroutine.
+type postgres struct {
+	prefix string
+	logger *zap.SugaredLogger
+	model  *model.Model
+	rate   *Rate
+}
+
+func newPostgres(name string, rate *Rate, logger *logging.Logger, model *model.Model) *postgres {
+	prefix := name + ":"
+	model.ScheduleRateLimitsPrune(prefix, rate.Per)
+
+	return &postgres{
+		prefix: prefix,
+		logger: logger.Log,
+		model:  model,
+		rate:   rate,
+	}
+}
+
+func (p *postgres) Take(key string) (bool, time.Duration) {
+	wait, err := p.model.TakeRateLimitToken(p.prefix+key, float64(p.rate.Tokens), p.rate.perSecond())
+	if err != nil {
+		p.logger.Errorf("Taking rate limit token of %s went in error: %s", key, err.Error())
+		return true, 0
+	}
+
+	return wait == 0, wait
+}
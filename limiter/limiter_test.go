@@ -0,0 +1,60 @@
+package limiter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRate(t *testing.T) {
+	rate, err := ParseRate("60/1m")
+
+	assert.Nil(t, err, "Error has to be nil")
+	assert.Equal(t, &Rate{Tokens: 60, Per: time.Minute}, rate, "Rate has to be parsed")
+
+	rate, err = ParseRate("")
+
+	assert.Nil(t, err, "Error has to be nil")
+	assert.Nil(t, rate, "Empty rate has to be nil")
+
+	for _, malformed := range []string{"60", "0/1m", "a/1m", "60/0s", "60/minute"} {
+		_, err = ParseRate(malformed)
+		assert.NotNil(t, err, "Error has to be not nil for %s", malformed)
+	}
+}
+
+func TestMemoryTake(t *testing.T) {
+	now := time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC)
+	limiter := newMemory(&Rate{Tokens: 2, Per: 2 * time.Second}, func() time.Time { return now })
+
+	allowed, _ := limiter.Take("ip:127.0.0.1")
+	assert.True(t, allowed, "First token has to be available")
+	allowed, _ = limiter.Take("ip:127.0.0.1")
+	assert.True(t, allowed, "Second token has to be available")
+
+	allowed, wait := limiter.Take("ip:127.0.0.1")
+	assert.False(t, allowed, "Third token must not be available")
+	assert.Equal(t, time.Second, wait, "Next token has to come after a second")
+
+	allowed, _ = limiter.Take("ip:127.0.0.2")
+	assert.True(t, allowed, "Buckets have to be kept by key")
+
+	now = now.Add(time.Second)
+	allowed, _ = limiter.Take("ip:127.0.0.1")
+	assert.True(t, allowed, "Bucket has to be refilled over time")
+	allowed, _ = limiter.Take("ip:127.0.0.1")
+	assert.False(t, allowed, "Bucket has to be refilled at its rate")
+}
+
+func TestMemorySweep(t *testing.T) {
+	now := time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC)
+	limiter := newMemory(&Rate{Tokens: 1, Per: time.Minute}, func() time.Time { return now })
+
+	limiter.Take("ip:127.0.0.1")
+	assert.Len(t, limiter.buckets, 1, "Bucket has to be kept")
+
+	now = now.Add(time.Minute)
+	limiter.Take("ip:127.0.0.2")
+	assert.Len(t, limiter.buckets, 1, "Full buckets have to be forgotten")
+}
@@ -0,0 +1,90 @@
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	poolAcquiredDesc = prometheus.NewDesc(namespace+"_db_pool_acquired_connections",
+		"Connections of the pool in use.", nil, nil)
+	poolIdleDesc = prometheus.NewDesc(namespace+"_db_pool_idle_connections",
+		"Idle connections of the pool.", nil, nil)
+	poolTotalDesc = prometheus.NewDesc(namespace+"_db_pool_total_connections",
+		"Connections of the pool, being established ones included.", nil, nil)
+	poolMaxDesc = prometheus.NewDesc(namespace+"_db_pool_max_connections",
+		"Largest size of the pool.", nil, nil)
+	poolAcquiresDesc = prometheus.NewDesc(namespace+"_db_pool_acquires_total",
+		"Successful connection acquisitions from the pool.", nil, nil)
+	poolAcquireSecondsDesc = prometheus.NewDesc(namespace+"_db_pool_acquire_seconds_total",
+		"Time spent acquiring connections from the pool.", nil, nil)
+	poolEmptyAcquiresDesc = prometheus.NewDesc(namespace+"_db_pool_empty_acquires_total",
+		"Acquisitions that had to wait for a connection as the pool was empty.", nil, nil)
+	poolCanceledAcquiresDesc = prometheus.NewDesc(namespace+"_db_pool_canceled_acquires_total",
+		"Acquisitions canceled before getting a connection.", nil, nil)
+	migrationVersionDesc = prometheus.NewDesc(namespace+"_schema_migration_version",
+		"Schema migration version applied at startup.", nil, nil)
+	migrationDirtyDesc = prometheus.NewDesc(namespace+"_schema_migration_dirty",
+		"1 when the schema migration applied at startup failed half way.", nil, nil)
+	fetchEventsQueuedDesc = prometheus.NewDesc(namespace+"_fetch_events_queued",
+		"Fetch events waiting to be sent to the event stream subscribers.", nil, nil)
+	webhookDeliveriesPendingDesc = prometheus.NewDesc(namespace+"_webhook_deliveries_pending",
+		"Webhook deliveries not delivered nor given up yet.", nil, nil)
+)
+
+// databaseCollector reads the database statistics when scraped.
+type databaseCollector struct {
+	database Database
+}
+
+func newDatabaseCollector(database Database) *databaseCollector {
+	return &databaseCollector{
+		database: database,
+	}
+}
+
+func (c *databaseCollector) Describe(descs chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{
+		poolAcquiredDesc,
+		poolIdleDesc,
+		poolTotalDesc,
+		poolMaxDesc,
+		poolAcquiresDesc,
+		poolAcquireSecondsDesc,
+		poolEmptyAcquiresDesc,
+		poolCanceledAcquiresDesc,
+		migrationVersionDesc,
+		migrationDirtyDesc,
+		fetchEventsQueuedDesc,
+		webhookDeliveriesPendingDesc,
+	} {
+		descs <- desc
+	}
+}
+
+func (c *databaseCollector) Collect(metrics chan<- prometheus.Metric) {
+	stat := c.database.PoolStat()
+	metrics <- prometheus.MustNewConstMetric(poolAcquiredDesc, prometheus.GaugeValue, float64(stat.AcquiredConns()))
+	metrics <- prometheus.MustNewConstMetric(poolIdleDesc, prometheus.GaugeValue, float64(stat.IdleConns()))
+	metrics <- prometheus.MustNewConstMetric(poolTotalDesc, prometheus.GaugeValue, float64(stat.TotalConns()))
+	metrics <- prometheus.MustNewConstMetric(poolMaxDesc, prometheus.GaugeValue, float64(stat.MaxConns()))
+	metrics <- prometheus.MustNewConstMetric(poolAcquiresDesc, prometheus.CounterValue, float64(stat.AcquireCount()))
+	metrics <- prometheus.MustNewConstMetric(poolAcquireSecondsDesc, prometheus.CounterValue, stat.AcquireDuration().Seconds())
+	metrics <- prometheus.MustNewConstMetric(poolEmptyAcquiresDesc, prometheus.CounterValue, float64(stat.EmptyAcquireCount()))
+	metrics <- prometheus.MustNewConstMetric(poolCanceledAcquiresDesc, prometheus.CounterValue, float64(stat.CanceledAcquireCount()))
+
+	version, dirty := c.database.MigrationVersion()
+	dirtyValue := 0.0
+	if dirty {
+		dirtyValue = 1
+	}
+
+	metrics <- prometheus.MustNewConstMetric(migrationVersionDesc, prometheus.GaugeValue, float64(version))
+	metrics <- prometheus.MustNewConstMetric(migrationDirtyDesc, prometheus.GaugeValue, dirtyValue)
+	metrics <- prometheus.MustNewConstMetric(fetchEventsQueuedDesc, prometheus.GaugeValue, float64(c.database.FetchEventsQueued()))
+
+	pending, err := c.database.PendingWebhookDeliveries()
+	if err != nil {
+		metrics <- prometheus.NewInvalidMetric(webhookDeliveriesPendingDesc, err)
+		return
+	}
+
+	metrics <- prometheus.MustNewConstMetric(webhookDeliveriesPendingDesc, prometheus.GaugeValue, float64(pending))
+}
@@ -0,0 +1,152 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	namespace = "mafiyrm"
+	// unmatchedRoute labels the requests no route matched, so that scans do
+	// not grow a label value per path.
+	unmatchedRoute = "unmatched"
+)
+
+// Database is the part of the model exposing its statistics.
+type Database interface {
+	PoolStat() *pgxpool.Stat
+	MigrationVersion() (uint, bool)
+	FetchEventsQueued() int
+	PendingWebhookDeliveries() (int64, error)
+}
+
+// Metrics holds the registry served in Prometheus exposition format and the
+// instruments updated while serving.
+type Metrics struct {
+	registry        *prometheus.Registry
+	requests        *prometheus.HistogramVec
+	fetchesRecorded prometheus.Counter
+	fetchesSkipped  *prometheus.CounterVec
+	fetchesFailed   prometheus.Counter
+}
+
+// New registers the process and runtime collectors, the http and fetch
+// instruments and, when database is not nil, the collector reading the
+// database statistics at each scrape.
+func New(database Database) *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "request_duration_seconds",
+			Help:      "Duration of the http requests, by route template, method and status.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method", "status"}),
+		fetchesRecorded: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "fetches_recorded_total",
+			Help:      "Pixel fetches stored.",
+		}),
+		fetchesSkipped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "fetches_skipped_total",
+			Help:      "Pixel fetches not stored by policy, by reason.",
+		}, []string{"reason"}),
+		fetchesFailed: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "fetches_failed_total",
+			Help:      "Pixel fetches that could not be stored.",
+		}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		collectors.NewGoCollector(),
+		m.requests,
+		m.fetchesRecorded,
+		m.fetchesSkipped,
+		m.fetchesFailed,
+	)
+
+	if database != nil {
+		m.registry.MustRegister(newDatabaseCollector(database))
+	}
+
+	return m
+}
+
+// Handler serves the registry.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// FetchRecorded counts a stored fetch.
+func (m *Metrics) FetchRecorded() {
+	m.fetchesRecorded.Inc()
+}
+
+// FetchSkipped counts a fetch not stored for reason.
+func (m *Metrics) FetchSkipped(reason string) {
+	m.fetchesSkipped.WithLabelValues(reason).Inc()
+}
+
+// FetchFailed counts a fetch that could not be stored.
+func (m *Metrics) FetchFailed() {
+	m.fetchesFailed.Inc()
+}
+
+// Instrument observes the duration of the requests served by next, labelled
+// with the template of the mux route they matched.
+func (m *Metrics) Instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := unmatchedRoute
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+		next.ServeHTTP(recorder, r)
+
+		m.requests.WithLabelValues(route, r.Method, strconv.Itoa(recorder.status)).Observe(time.Since(start).Seconds())
+	})
+}
+
+// statusRecorder keeps the status written through it, it stays a Flusher for
+// the event streams.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *statusRecorder) Flush() {
+	r.wroteHeader = true
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
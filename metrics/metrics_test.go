@@ -0,0 +1,70 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func scrape(m *Metrics) string {
+	recorder := httptest.NewRecorder()
+	m.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	return recorder.Body.String()
+}
+
+func TestInstrument(t *testing.T) {
+	m := New(nil)
+	router := mux.NewRouter()
+	router.Use(m.Instrument)
+	router.NotFoundHandler = m.Instrument(http.NotFoundHandler())
+	router.Path("/images/{uuid}").Methods("GET").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+		w.WriteHeader(http.StatusOK)
+	})
+	router.Path("/events").Methods("GET").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, flushes := w.(http.Flusher)
+		assert.True(t, flushes, "Instrumented writers have to flush")
+		w.Write([]byte("data"))
+	})
+
+	for _, path := range []string{"/images/a", "/images/b", "/events", "/wp-login.php"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	exposition := scrape(m)
+	for _, expected := range []string{
+		`mafiyrm_http_request_duration_seconds_count{method="GET",route="/images/{uuid}",status="418"} 2`,
+		`mafiyrm_http_request_duration_seconds_count{method="GET",route="/events",status="200"} 1`,
+		`mafiyrm_http_request_duration_seconds_count{method="GET",route="unmatched",status="404"} 1`,
+	} {
+		assert.True(t, strings.Contains(exposition, expected), "Exposition has to contain %s", expected)
+	}
+}
+
+func TestFetchCounters(t *testing.T) {
+	m := New(nil)
+	m.FetchRecorded()
+	m.FetchRecorded()
+	m.FetchFailed()
+
+	exposition := scrape(m)
+	assert.True(t, strings.Contains(exposition, "mafiyrm_fetches_recorded_total 2"), "Recorded fetches have to be counted")
+	assert.True(t, strings.Contains(exposition, "mafiyrm_fetches_failed_total 1"), "Failed fetches have to be counted")
+}
+
+func TestFetchSkippedCounter(t *testing.T) {
+	m := New(nil)
+	m.FetchSkipped("duplicate")
+	m.FetchSkipped("duplicate")
+	m.FetchSkipped("out-of-window")
+
+	exposition := scrape(m)
+	assert.True(t, strings.Contains(exposition, `mafiyrm_fetches_skipped_total{reason="duplicate"} 2`), "Skipped fetches have to be counted by reason")
+	assert.True(t, strings.Contains(exposition, `mafiyrm_fetches_skipped_total{reason="out-of-window"} 1`), "Skipped fetches have to be counted by reason")
+	assert.True(t, strings.Contains(exposition, "mafiyrm_fetches_recorded_total 0"), "Skipped fetches must not be counted as recorded")
+}
@@ -0,0 +1,49 @@
+-- Images and campaigns are only unique per tenant from here on: going back
+-- is refused while two tenants share a used_in or a campaign name, rather
+-- than dropping the data of one of them.
+DO
+$do$
+BEGIN
+  IF EXISTS (
+    SELECT 1 FROM mafiyrm.images GROUP BY used_in HAVING COUNT(*) > 1
+  ) THEN
+    RAISE EXCEPTION 'cannot revert tenants: some images of different tenants share their used_in';
+  END IF;
+
+  IF EXISTS (
+    SELECT 1 FROM mafiyrm.campaigns GROUP BY name HAVING COUNT(*) > 1
+  ) THEN
+    RAISE EXCEPTION 'cannot revert tenants: some campaigns of different tenants share their name';
+  END IF;
+END
+$do$;
+
+ALTER TABLE mafiyrm.api_keys
+  DROP COLUMN IF EXISTS tenant_fk;
+
+DROP INDEX IF EXISTS mafiyrm.webhooks_tenant_fk_idx;
+
+ALTER TABLE mafiyrm.webhooks
+  DROP COLUMN IF EXISTS tenant_fk;
+
+ALTER TABLE mafiyrm.images
+  DROP CONSTRAINT IF EXISTS images_campaign_fk_fkey,
+  DROP CONSTRAINT images_pkey;
+ALTER TABLE mafiyrm.images
+  ADD CONSTRAINT images_pkey PRIMARY KEY (used_in),
+  ADD CONSTRAINT images_campaign_fk_fkey
+    FOREIGN KEY (campaign_fk)
+    REFERENCES mafiyrm.campaigns (id);
+
+ALTER TABLE mafiyrm.images
+  DROP COLUMN IF EXISTS tenant_fk;
+
+ALTER TABLE mafiyrm.campaigns
+  DROP CONSTRAINT IF EXISTS campaigns_tenant_id_key,
+  DROP CONSTRAINT IF EXISTS campaigns_tenant_name_key,
+  ADD CONSTRAINT campaigns_name_key UNIQUE (name);
+
+ALTER TABLE mafiyrm.campaigns
+  DROP COLUMN IF EXISTS tenant_fk;
+
+DROP TABLE IF EXISTS mafiyrm.tenants CASCADE;
@@ -0,0 +1,88 @@
+CREATE TABLE IF NOT EXISTS mafiyrm.tenants (
+  id UUID NOT NULL UNIQUE,
+  name VARCHAR(255) NOT NULL UNIQUE,
+  max_images INTEGER,
+  max_campaigns INTEGER,
+  last_update_date TIMESTAMP WITH TIME ZONE,
+  create_date TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id),
+  CONSTRAINT tenants_quotas_check CHECK (
+    (max_images IS NULL OR max_images >= 0)
+    AND (max_campaigns IS NULL OR max_campaigns >= 0)
+  )
+);
+
+DROP TRIGGER IF EXISTS update_last_update_date
+  ON mafiyrm.tenants;
+CREATE TRIGGER update_last_update_date
+  BEFORE UPDATE
+  ON mafiyrm.tenants
+  FOR EACH ROW
+  EXECUTE PROCEDURE mafiyrm.update_last_update_date_column();
+
+DROP TRIGGER IF EXISTS generate_id ON mafiyrm.tenants;
+CREATE TRIGGER generate_id
+  BEFORE INSERT
+  ON mafiyrm.tenants
+  FOR EACH ROW
+  EXECUTE PROCEDURE mafiyrm.generate_id();
+
+-- Everything recorded before tenants existed belongs to the default tenant.
+INSERT INTO mafiyrm.tenants (id, name)
+VALUES ('00000000-0000-0000-0000-000000000000', 'default')
+ON CONFLICT DO NOTHING;
+
+---
+
+ALTER TABLE mafiyrm.campaigns
+  ADD COLUMN IF NOT EXISTS tenant_fk UUID NOT NULL
+  DEFAULT '00000000-0000-0000-0000-000000000000'
+  REFERENCES mafiyrm.tenants (id);
+ALTER TABLE mafiyrm.campaigns
+  ALTER COLUMN tenant_fk DROP DEFAULT;
+
+ALTER TABLE mafiyrm.campaigns
+  DROP CONSTRAINT IF EXISTS campaigns_name_key,
+  ADD CONSTRAINT campaigns_tenant_name_key UNIQUE (tenant_fk, name),
+  ADD CONSTRAINT campaigns_tenant_id_key UNIQUE (tenant_fk, id);
+
+---
+
+ALTER TABLE mafiyrm.images
+  ADD COLUMN IF NOT EXISTS tenant_fk UUID NOT NULL
+  DEFAULT '00000000-0000-0000-0000-000000000000'
+  REFERENCES mafiyrm.tenants (id);
+ALTER TABLE mafiyrm.images
+  ALTER COLUMN tenant_fk DROP DEFAULT;
+
+-- Images are told apart by where they are used within their tenant, and can
+-- only join campaigns of the same tenant.
+ALTER TABLE mafiyrm.images
+  DROP CONSTRAINT images_pkey,
+  DROP CONSTRAINT IF EXISTS images_campaign_fk_fkey;
+ALTER TABLE mafiyrm.images
+  ADD CONSTRAINT images_pkey PRIMARY KEY (tenant_fk, used_in),
+  ADD CONSTRAINT images_campaign_fk_fkey
+    FOREIGN KEY (tenant_fk, campaign_fk)
+    REFERENCES mafiyrm.campaigns (tenant_fk, id);
+
+---
+
+ALTER TABLE mafiyrm.webhooks
+  ADD COLUMN IF NOT EXISTS tenant_fk UUID NOT NULL
+  DEFAULT '00000000-0000-0000-0000-000000000000'
+  REFERENCES mafiyrm.tenants (id);
+ALTER TABLE mafiyrm.webhooks
+  ALTER COLUMN tenant_fk DROP DEFAULT;
+
+CREATE INDEX IF NOT EXISTS webhooks_tenant_fk_idx
+  ON mafiyrm.webhooks (tenant_fk);
+
+---
+
+ALTER TABLE mafiyrm.api_keys
+  ADD COLUMN IF NOT EXISTS tenant_fk UUID NOT NULL
+  DEFAULT '00000000-0000-0000-0000-000000000000'
+  REFERENCES mafiyrm.tenants (id);
+ALTER TABLE mafiyrm.api_keys
+  ALTER COLUMN tenant_fk DROP DEFAULT;
@@ -0,0 +1,5 @@
+DROP FUNCTION IF EXISTS mafiyrm.prune_rate_limits(VARCHAR, DOUBLE PRECISION);
+DROP FUNCTION IF EXISTS mafiyrm.take_rate_limit_token(VARCHAR, DOUBLE PRECISION, DOUBLE PRECISION);
+
+DROP INDEX IF EXISTS mafiyrm.rate_limits_refill_date_idx;
+DROP TABLE IF EXISTS mafiyrm.rate_limits CASCADE;
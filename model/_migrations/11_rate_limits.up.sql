@@ -0,0 +1,58 @@
+CREATE UNLOGGED TABLE IF NOT EXISTS mafiyrm.rate_limits (
+  bucket VARCHAR(255) NOT NULL,
+  tokens DOUBLE PRECISION NOT NULL,
+  refill_date TIMESTAMP WITH TIME ZONE NOT NULL,
+  PRIMARY KEY (bucket)
+);
+
+CREATE INDEX IF NOT EXISTS rate_limits_refill_date_idx
+  ON mafiyrm.rate_limits (refill_date);
+
+---
+
+-- Takes a token from the bucket, refilled at per_second up to capacity, and
+-- returns 0 when it was available or the seconds until the next one.
+CREATE OR REPLACE FUNCTION mafiyrm.take_rate_limit_token(bucket_key VARCHAR, capacity DOUBLE PRECISION, per_second DOUBLE PRECISION)
+RETURNS DOUBLE PRECISION AS $$
+DECLARE
+  now_date TIMESTAMP WITH TIME ZONE := clock_timestamp();
+  available DOUBLE PRECISION;
+BEGIN
+  INSERT INTO mafiyrm.rate_limits AS limits (bucket, tokens, refill_date)
+  VALUES (bucket_key, capacity, now_date)
+  ON CONFLICT ON CONSTRAINT rate_limits_pkey
+  DO UPDATE
+  SET
+    tokens = LEAST(capacity, limits.tokens + EXTRACT(EPOCH FROM now_date - limits.refill_date) * per_second),
+    refill_date = now_date
+  RETURNING limits.tokens INTO available;
+
+  IF available >= 1 THEN
+    UPDATE mafiyrm.rate_limits
+    SET tokens = tokens - 1
+    WHERE bucket = bucket_key;
+
+    RETURN 0;
+  END IF;
+
+  RETURN (1 - available) / per_second;
+END;
+$$ language 'plpgsql'
+SECURITY DEFINER
+SET search_path = mafiyrm, pg_temp;
+
+CREATE OR REPLACE FUNCTION mafiyrm.prune_rate_limits(bucket_prefix VARCHAR, idle_seconds DOUBLE PRECISION)
+RETURNS BIGINT AS $$
+DECLARE
+  pruned BIGINT;
+BEGIN
+  DELETE FROM mafiyrm.rate_limits
+  WHERE bucket LIKE bucket_prefix || '%'
+    AND refill_date < clock_timestamp() - make_interval(secs => idle_seconds);
+
+  GET DIAGNOSTICS pruned = ROW_COUNT;
+  RETURN pruned;
+END;
+$$ language 'plpgsql'
+SECURITY DEFINER
+SET search_path = mafiyrm, pg_temp;
@@ -0,0 +1,2 @@
+ALTER TABLE mafiyrm.images_accessed
+  DROP COLUMN IF EXISTS category;
@@ -0,0 +1,2 @@
+ALTER TABLE mafiyrm.images_accessed
+  ADD COLUMN IF NOT EXISTS category VARCHAR(32);
@@ -0,0 +1,6 @@
+ALTER TABLE mafiyrm.images_accessed
+  DROP COLUMN IF EXISTS mail_client,
+  DROP COLUMN IF EXISTS device_type,
+  DROP COLUMN IF EXISTS os,
+  DROP COLUMN IF EXISTS browser_version,
+  DROP COLUMN IF EXISTS browser;
@@ -0,0 +1,6 @@
+ALTER TABLE mafiyrm.images_accessed
+  ADD COLUMN IF NOT EXISTS browser VARCHAR(64),
+  ADD COLUMN IF NOT EXISTS browser_version VARCHAR(64),
+  ADD COLUMN IF NOT EXISTS os VARCHAR(64),
+  ADD COLUMN IF NOT EXISTS device_type VARCHAR(16),
+  ADD COLUMN IF NOT EXISTS mail_client VARCHAR(64);
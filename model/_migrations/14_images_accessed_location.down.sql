@@ -0,0 +1,5 @@
+ALTER TABLE mafiyrm.images_accessed
+  DROP COLUMN IF EXISTS as_organization,
+  DROP COLUMN IF EXISTS asn,
+  DROP COLUMN IF EXISTS city,
+  DROP COLUMN IF EXISTS country;
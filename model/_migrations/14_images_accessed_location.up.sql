@@ -0,0 +1,5 @@
+ALTER TABLE mafiyrm.images_accessed
+  ADD COLUMN IF NOT EXISTS country CHAR(2),
+  ADD COLUMN IF NOT EXISTS city VARCHAR(128),
+  ADD COLUMN IF NOT EXISTS asn BIGINT,
+  ADD COLUMN IF NOT EXISTS as_organization VARCHAR(256);
@@ -0,0 +1,11 @@
+ALTER TABLE mafiyrm.images_accessed_hourly
+  DROP COLUMN IF EXISTS deduplicated_fetches;
+
+ALTER TABLE mafiyrm.images_accessed
+  DROP COLUMN IF EXISTS duplicate;
+
+DROP FUNCTION IF EXISTS mafiyrm.prune_fetch_dedup(DOUBLE PRECISION);
+DROP FUNCTION IF EXISTS mafiyrm.mark_fetch_seen(VARCHAR, DOUBLE PRECISION);
+
+DROP INDEX IF EXISTS mafiyrm.fetch_dedup_seen_date_idx;
+DROP TABLE IF EXISTS mafiyrm.fetch_dedup CASCADE;
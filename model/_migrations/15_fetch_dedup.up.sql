@@ -0,0 +1,59 @@
+CREATE UNLOGGED TABLE IF NOT EXISTS mafiyrm.fetch_dedup (
+  fingerprint CHAR(64) NOT NULL,
+  seen_date TIMESTAMP WITH TIME ZONE NOT NULL,
+  PRIMARY KEY (fingerprint)
+);
+
+CREATE INDEX IF NOT EXISTS fetch_dedup_seen_date_idx
+  ON mafiyrm.fetch_dedup (seen_date);
+
+---
+
+-- Records a fetch with fingerprint and returns whether another one was
+-- recorded within the window before it. Duplicates do not extend the window.
+CREATE OR REPLACE FUNCTION mafiyrm.mark_fetch_seen(fingerprint_key VARCHAR, window_seconds DOUBLE PRECISION)
+RETURNS BOOLEAN AS $$
+DECLARE
+  now_date TIMESTAMP WITH TIME ZONE := clock_timestamp();
+  first_seen BOOLEAN;
+BEGIN
+  INSERT INTO mafiyrm.fetch_dedup AS dedup (fingerprint, seen_date)
+  VALUES (fingerprint_key, now_date)
+  ON CONFLICT ON CONSTRAINT fetch_dedup_pkey
+  DO UPDATE
+  SET seen_date = now_date
+  WHERE dedup.seen_date <= now_date - make_interval(secs => window_seconds)
+  RETURNING TRUE INTO first_seen;
+
+  RETURN first_seen IS NULL;
+END;
+$$ language 'plpgsql'
+SECURITY DEFINER
+SET search_path = mafiyrm, pg_temp;
+
+CREATE OR REPLACE FUNCTION mafiyrm.prune_fetch_dedup(idle_seconds DOUBLE PRECISION)
+RETURNS BIGINT AS $$
+DECLARE
+  pruned BIGINT;
+BEGIN
+  DELETE FROM mafiyrm.fetch_dedup
+  WHERE seen_date < clock_timestamp() - make_interval(secs => idle_seconds);
+
+  GET DIAGNOSTICS pruned = ROW_COUNT;
+  RETURN pruned;
+END;
+$$ language 'plpgsql'
+SECURITY DEFINER
+SET search_path = mafiyrm, pg_temp;
+
+---
+
+ALTER TABLE mafiyrm.images_accessed
+  ADD COLUMN IF NOT EXISTS duplicate BOOLEAN NOT NULL DEFAULT FALSE;
+
+ALTER TABLE mafiyrm.images_accessed_hourly
+  ADD COLUMN IF NOT EXISTS deduplicated_fetches BIGINT NOT NULL DEFAULT 0;
+
+-- No fetch was marked as duplicate before.
+UPDATE mafiyrm.images_accessed_hourly
+SET deduplicated_fetches = fetches;
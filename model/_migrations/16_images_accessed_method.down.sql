@@ -0,0 +1,6 @@
+ALTER TABLE mafiyrm.images_accessed_hourly
+  DROP COLUMN IF EXISTS head_fetches;
+
+ALTER TABLE mafiyrm.images_accessed
+  DROP COLUMN IF EXISTS attributes,
+  DROP COLUMN IF EXISTS method;
@@ -0,0 +1,6 @@
+ALTER TABLE mafiyrm.images_accessed
+  ADD COLUMN IF NOT EXISTS method VARCHAR(8) NOT NULL DEFAULT 'GET',
+  ADD COLUMN IF NOT EXISTS attributes JSONB;
+
+ALTER TABLE mafiyrm.images_accessed_hourly
+  ADD COLUMN IF NOT EXISTS head_fetches BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,2 @@
+ALTER TABLE mafiyrm.images
+  DROP COLUMN IF EXISTS first_fetch_date;
@@ -0,0 +1,13 @@
+ALTER TABLE mafiyrm.images
+  ADD COLUMN IF NOT EXISTS first_fetch_date TIMESTAMP WITH TIME ZONE;
+
+UPDATE mafiyrm.images
+SET first_fetch_date = first_fetches.first_fetch_date
+FROM (
+  SELECT image_fk, MIN(create_date) AS first_fetch_date
+  FROM mafiyrm.images_accessed
+  WHERE method <> 'HEAD'
+  GROUP BY image_fk
+) AS first_fetches
+WHERE images.id = first_fetches.image_fk
+  AND images.first_fetch_date IS NULL;
@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS mafiyrm.images_accessed_heap (
+  image_fk UUID NOT NULL,
+  who_fk UUID NOT NULL,
+  create_date TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO mafiyrm.images_accessed_heap (image_fk, who_fk, create_date)
+  SELECT image_fk, who_fk, create_date
+  FROM mafiyrm.images_accessed;
+
+DROP TABLE IF EXISTS mafiyrm.images_accessed CASCADE;
+
+ALTER TABLE mafiyrm.images_accessed_heap
+  RENAME TO images_accessed;
+
+CREATE INDEX IF NOT EXISTS images_accessed_image_fk_idx
+  ON mafiyrm.images_accessed (image_fk);
+
+CREATE INDEX IF NOT EXISTS images_accessed_who_idx
+  ON mafiyrm.images_accessed (who_fk);
+
+DROP FUNCTION IF EXISTS mafiyrm.retire_images_accessed_partitions(INTEGER, BOOLEAN);
+DROP FUNCTION IF EXISTS mafiyrm.create_images_accessed_partitions(INTEGER);
+DROP FUNCTION IF EXISTS mafiyrm.create_images_accessed_partition(TIMESTAMP WITH TIME ZONE);
@@ -0,0 +1,117 @@
+ALTER TABLE IF EXISTS mafiyrm.images_accessed
+  RENAME TO images_accessed_heap;
+ALTER INDEX IF EXISTS mafiyrm.images_accessed_image_fk_idx
+  RENAME TO images_accessed_heap_image_fk_idx;
+ALTER INDEX IF EXISTS mafiyrm.images_accessed_who_idx
+  RENAME TO images_accessed_heap_who_idx;
+
+CREATE TABLE IF NOT EXISTS mafiyrm.images_accessed (
+  image_fk UUID NOT NULL,
+  who_fk UUID NOT NULL,
+  create_date TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+) PARTITION BY RANGE (create_date);
+
+CREATE INDEX IF NOT EXISTS images_accessed_image_fk_idx
+  ON mafiyrm.images_accessed (image_fk);
+
+CREATE INDEX IF NOT EXISTS images_accessed_who_idx
+  ON mafiyrm.images_accessed (who_fk);
+
+---
+
+CREATE OR REPLACE FUNCTION mafiyrm.create_images_accessed_partition(month_of TIMESTAMP WITH TIME ZONE)
+RETURNS TEXT AS $$
+DECLARE
+  partition_start TIMESTAMP := date_trunc('month', month_of AT TIME ZONE 'UTC');
+  partition_name TEXT := 'images_accessed_' || to_char(partition_start, 'YYYY_MM');
+BEGIN
+  IF to_regclass('mafiyrm.' || partition_name) IS NOT NULL THEN
+    RETURN NULL;
+  END IF;
+
+  EXECUTE format(
+    'CREATE TABLE mafiyrm.%I PARTITION OF mafiyrm.images_accessed FOR VALUES FROM (%L) TO (%L)',
+    partition_name,
+    partition_start AT TIME ZONE 'UTC',
+    (partition_start + INTERVAL '1 month') AT TIME ZONE 'UTC'
+  );
+
+  RETURN partition_name;
+END;
+$$ language 'plpgsql'
+SECURITY DEFINER
+SET search_path = mafiyrm, pg_temp;
+
+CREATE OR REPLACE FUNCTION mafiyrm.create_images_accessed_partitions(months_ahead INTEGER)
+RETURNS SETOF TEXT AS $$
+DECLARE
+  created TEXT;
+BEGIN
+  FOR i IN 0..months_ahead LOOP
+    created := mafiyrm.create_images_accessed_partition(now() + make_interval(months => i));
+    IF created IS NOT NULL THEN
+      RETURN NEXT created;
+    END IF;
+  END LOOP;
+END;
+$$ language 'plpgsql'
+SECURITY DEFINER
+SET search_path = mafiyrm, pg_temp;
+
+CREATE OR REPLACE FUNCTION mafiyrm.retire_images_accessed_partitions(months_retained INTEGER, drop_partitions BOOLEAN)
+RETURNS SETOF TEXT AS $$
+DECLARE
+  threshold TIMESTAMP := date_trunc('month', now() AT TIME ZONE 'UTC') - make_interval(months => months_retained);
+  partition_name TEXT;
+BEGIN
+  FOR partition_name IN
+    SELECT child.relname
+    FROM pg_catalog.pg_inherits
+    JOIN pg_catalog.pg_class parent ON pg_inherits.inhparent = parent.oid
+    JOIN pg_catalog.pg_class child ON pg_inherits.inhrelid = child.oid
+    JOIN pg_catalog.pg_namespace namespace ON parent.relnamespace = namespace.oid
+    WHERE namespace.nspname = 'mafiyrm'
+      AND parent.relname = 'images_accessed'
+      AND child.relname ~ '^images_accessed_[0-9]{4}_[0-9]{2}$'
+    ORDER BY child.relname
+  LOOP
+    IF to_date(right(partition_name, 7), 'YYYY_MM')::timestamp < threshold THEN
+      IF drop_partitions THEN
+        EXECUTE format('DROP TABLE mafiyrm.%I', partition_name);
+      ELSE
+        EXECUTE format('ALTER TABLE mafiyrm.images_accessed DETACH PARTITION mafiyrm.%I', partition_name);
+      END IF;
+
+      RETURN NEXT partition_name;
+    END IF;
+  END LOOP;
+END;
+$$ language 'plpgsql'
+SECURITY DEFINER
+SET search_path = mafiyrm, pg_temp;
+
+---
+
+DO
+$do$
+DECLARE
+  month_of TIMESTAMP WITH TIME ZONE;
+BEGIN
+  SELECT date_trunc('month', COALESCE(MIN(create_date), now()) AT TIME ZONE 'UTC') AT TIME ZONE 'UTC'
+  INTO month_of
+  FROM mafiyrm.images_accessed_heap;
+
+  WHILE month_of < now() LOOP
+    PERFORM mafiyrm.create_images_accessed_partition(month_of);
+    month_of := month_of + INTERVAL '1 month';
+  END LOOP;
+
+  PERFORM mafiyrm.create_images_accessed_partitions(3);
+END
+$do$;
+
+INSERT INTO mafiyrm.images_accessed (image_fk, who_fk, create_date)
+  SELECT image_fk, who_fk, create_date
+  FROM mafiyrm.images_accessed_heap;
+
+DROP TABLE IF EXISTS mafiyrm.images_accessed_heap CASCADE;
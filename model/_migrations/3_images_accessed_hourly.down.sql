@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS mafiyrm.images_accessed_hourly_bucket_idx;
+
+DROP TABLE IF EXISTS mafiyrm.images_accessed_hourly CASCADE;
@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS mafiyrm.images_accessed_hourly (
+  image_fk UUID NOT NULL,
+  bucket TIMESTAMP WITH TIME ZONE NOT NULL,
+  fetches BIGINT NOT NULL DEFAULT 0,
+  fetchers BIGINT NOT NULL DEFAULT 0,
+  last_update_date TIMESTAMP WITH TIME ZONE,
+  create_date TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (image_fk, bucket)
+);
+
+CREATE INDEX IF NOT EXISTS images_accessed_hourly_bucket_idx
+  ON mafiyrm.images_accessed_hourly (bucket);
+
+DROP TRIGGER IF EXISTS update_last_update_date
+  ON mafiyrm.images_accessed_hourly;
+CREATE TRIGGER update_last_update_date
+  BEFORE UPDATE
+  ON mafiyrm.images_accessed_hourly
+  FOR EACH ROW
+  EXECUTE PROCEDURE mafiyrm.update_last_update_date_column();
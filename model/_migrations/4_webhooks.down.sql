@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS mafiyrm.webhook_deliveries_pending_idx;
+DROP INDEX IF EXISTS mafiyrm.webhook_deliveries_webhook_fk_idx;
+DROP INDEX IF EXISTS mafiyrm.webhooks_image_fk_idx;
+
+DROP TABLE IF EXISTS mafiyrm.webhook_deliveries CASCADE;
+DROP TABLE IF EXISTS mafiyrm.webhooks CASCADE;
@@ -0,0 +1,66 @@
+CREATE TABLE IF NOT EXISTS mafiyrm.webhooks (
+  id UUID NOT NULL UNIQUE,
+  image_fk UUID,
+  url VARCHAR(2048) NOT NULL,
+  secret VARCHAR(255) NOT NULL,
+  first_fetch_only BOOLEAN NOT NULL DEFAULT FALSE,
+  disabled BOOLEAN NOT NULL DEFAULT FALSE,
+  last_update_date TIMESTAMP WITH TIME ZONE,
+  create_date TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id)
+);
+
+CREATE INDEX IF NOT EXISTS webhooks_image_fk_idx
+  ON mafiyrm.webhooks (image_fk);
+
+DROP TRIGGER IF EXISTS update_last_update_date
+  ON mafiyrm.webhooks;
+CREATE TRIGGER update_last_update_date
+  BEFORE UPDATE
+  ON mafiyrm.webhooks
+  FOR EACH ROW
+  EXECUTE PROCEDURE mafiyrm.update_last_update_date_column();
+
+DROP TRIGGER IF EXISTS generate_id ON mafiyrm.webhooks;
+CREATE TRIGGER generate_id
+  BEFORE INSERT
+  ON mafiyrm.webhooks
+  FOR EACH ROW
+  EXECUTE PROCEDURE mafiyrm.generate_id();
+
+---
+
+CREATE TABLE IF NOT EXISTS mafiyrm.webhook_deliveries (
+  id UUID NOT NULL UNIQUE,
+  webhook_fk UUID NOT NULL REFERENCES mafiyrm.webhooks (id),
+  payload JSONB NOT NULL,
+  status VARCHAR(16) NOT NULL DEFAULT 'pending',
+  attempts INTEGER NOT NULL DEFAULT 0,
+  next_attempt_date TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  last_error TEXT,
+  last_update_date TIMESTAMP WITH TIME ZONE,
+  create_date TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id)
+);
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_webhook_fk_idx
+  ON mafiyrm.webhook_deliveries (webhook_fk);
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_pending_idx
+  ON mafiyrm.webhook_deliveries (next_attempt_date)
+  WHERE status = 'pending';
+
+DROP TRIGGER IF EXISTS update_last_update_date
+  ON mafiyrm.webhook_deliveries;
+CREATE TRIGGER update_last_update_date
+  BEFORE UPDATE
+  ON mafiyrm.webhook_deliveries
+  FOR EACH ROW
+  EXECUTE PROCEDURE mafiyrm.update_last_update_date_column();
+
+DROP TRIGGER IF EXISTS generate_id ON mafiyrm.webhook_deliveries;
+CREATE TRIGGER generate_id
+  BEFORE INSERT
+  ON mafiyrm.webhook_deliveries
+  FOR EACH ROW
+  EXECUTE PROCEDURE mafiyrm.generate_id();
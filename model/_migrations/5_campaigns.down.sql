@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS mafiyrm.images_campaign_fk_idx;
+
+ALTER TABLE mafiyrm.images
+  DROP COLUMN IF EXISTS campaign_fk;
+
+DROP TABLE IF EXISTS mafiyrm.campaigns CASCADE;
@@ -0,0 +1,33 @@
+CREATE TABLE IF NOT EXISTS mafiyrm.campaigns (
+  id UUID NOT NULL UNIQUE,
+  name VARCHAR(255) NOT NULL UNIQUE,
+  description TEXT NOT NULL DEFAULT '',
+  start_date TIMESTAMP WITH TIME ZONE,
+  end_date TIMESTAMP WITH TIME ZONE,
+  last_update_date TIMESTAMP WITH TIME ZONE,
+  create_date TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id)
+);
+
+DROP TRIGGER IF EXISTS update_last_update_date
+  ON mafiyrm.campaigns;
+CREATE TRIGGER update_last_update_date
+  BEFORE UPDATE
+  ON mafiyrm.campaigns
+  FOR EACH ROW
+  EXECUTE PROCEDURE mafiyrm.update_last_update_date_column();
+
+DROP TRIGGER IF EXISTS generate_id ON mafiyrm.campaigns;
+CREATE TRIGGER generate_id
+  BEFORE INSERT
+  ON mafiyrm.campaigns
+  FOR EACH ROW
+  EXECUTE PROCEDURE mafiyrm.generate_id();
+
+---
+
+ALTER TABLE mafiyrm.images
+  ADD COLUMN IF NOT EXISTS campaign_fk UUID REFERENCES mafiyrm.campaigns (id);
+
+CREATE INDEX IF NOT EXISTS images_campaign_fk_idx
+  ON mafiyrm.images (campaign_fk);
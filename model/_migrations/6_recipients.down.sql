@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS mafiyrm.images_accessed_recipient_idx;
+
+ALTER TABLE mafiyrm.images_accessed
+  DROP COLUMN IF EXISTS recipient;
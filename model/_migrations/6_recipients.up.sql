@@ -0,0 +1,6 @@
+ALTER TABLE mafiyrm.images_accessed
+  ADD COLUMN IF NOT EXISTS recipient VARCHAR(255);
+
+CREATE INDEX IF NOT EXISTS images_accessed_recipient_idx
+  ON mafiyrm.images_accessed (image_fk, recipient)
+  WHERE recipient IS NOT NULL;
@@ -0,0 +1,9 @@
+ALTER TABLE mafiyrm.images_accessed_hourly
+  DROP COLUMN IF EXISTS out_of_window_fetches;
+
+ALTER TABLE mafiyrm.images_accessed
+  DROP COLUMN IF EXISTS out_of_window;
+
+ALTER TABLE mafiyrm.images
+  DROP COLUMN IF EXISTS expires_at,
+  DROP COLUMN IF EXISTS active_from;
@@ -0,0 +1,9 @@
+ALTER TABLE mafiyrm.images
+  ADD COLUMN IF NOT EXISTS active_from TIMESTAMP WITH TIME ZONE,
+  ADD COLUMN IF NOT EXISTS expires_at TIMESTAMP WITH TIME ZONE;
+
+ALTER TABLE mafiyrm.images_accessed
+  ADD COLUMN IF NOT EXISTS out_of_window BOOLEAN NOT NULL DEFAULT FALSE;
+
+ALTER TABLE mafiyrm.images_accessed_hourly
+  ADD COLUMN IF NOT EXISTS out_of_window_fetches BIGINT NOT NULL DEFAULT 0;
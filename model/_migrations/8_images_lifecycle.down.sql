@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS mafiyrm.images_used_in_pattern_idx;
+DROP INDEX IF EXISTS mafiyrm.images_create_date_idx;
+
+ALTER TABLE mafiyrm.images
+  DROP CONSTRAINT IF EXISTS images_window_check;
+
+ALTER TABLE mafiyrm.images
+  DROP COLUMN IF EXISTS delete_date,
+  DROP COLUMN IF EXISTS disabled;
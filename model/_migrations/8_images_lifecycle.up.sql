@@ -0,0 +1,14 @@
+ALTER TABLE mafiyrm.images
+  ADD COLUMN IF NOT EXISTS disabled BOOLEAN NOT NULL DEFAULT FALSE,
+  ADD COLUMN IF NOT EXISTS delete_date TIMESTAMP WITH TIME ZONE;
+
+ALTER TABLE mafiyrm.images
+  ADD CONSTRAINT images_window_check
+  CHECK (active_from IS NULL OR expires_at IS NULL OR active_from < expires_at)
+  NOT VALID;
+
+CREATE INDEX IF NOT EXISTS images_create_date_idx
+  ON mafiyrm.images (create_date);
+
+CREATE INDEX IF NOT EXISTS images_used_in_pattern_idx
+  ON mafiyrm.images (used_in varchar_pattern_ops);
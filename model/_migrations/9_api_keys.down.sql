@@ -0,0 +1 @@
+DROP TABLE IF EXISTS mafiyrm.api_keys CASCADE;
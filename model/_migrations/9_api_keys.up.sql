@@ -0,0 +1,27 @@
+CREATE TABLE IF NOT EXISTS mafiyrm.api_keys (
+  id UUID NOT NULL UNIQUE,
+  name VARCHAR(255) NOT NULL,
+  hash CHAR(64) NOT NULL UNIQUE,
+  scope VARCHAR(16) NOT NULL,
+  revoked BOOLEAN NOT NULL DEFAULT FALSE,
+  last_used_date TIMESTAMP WITH TIME ZONE,
+  last_update_date TIMESTAMP WITH TIME ZONE,
+  create_date TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id),
+  CONSTRAINT api_keys_scope_check CHECK (scope IN ('read', 'create', 'admin'))
+);
+
+DROP TRIGGER IF EXISTS update_last_update_date
+  ON mafiyrm.api_keys;
+CREATE TRIGGER update_last_update_date
+  BEFORE UPDATE
+  ON mafiyrm.api_keys
+  FOR EACH ROW
+  EXECUTE PROCEDURE mafiyrm.update_last_update_date_column();
+
+DROP TRIGGER IF EXISTS generate_id ON mafiyrm.api_keys;
+CREATE TRIGGER generate_id
+  BEFORE INSERT
+  ON mafiyrm.api_keys
+  FOR EACH ROW
+  EXECUTE PROCEDURE mafiyrm.generate_id();
@@ -0,0 +1,222 @@
+package model
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	ApiKeyScopeRead   = "read"
+	ApiKeyScopeCreate = "create"
+	ApiKeyScopeAdmin  = "admin"
+
+	apiKeyPrefix = "mafiyrm_"
+)
+
+var (
+	ErrApiKeyNotFound     = errors.New("api key not found")
+	ErrApiKeyScopeInvalid = fmt.Errorf("api key scope must be %s, %s or %s", ApiKeyScopeRead, ApiKeyScopeCreate, ApiKeyScopeAdmin)
+)
+
+// apiKeyScopes ranks scopes, a key is granted every scope ranked up to its own.
+var apiKeyScopes = map[string]int{
+	ApiKeyScopeRead:   1,
+	ApiKeyScopeCreate: 2,
+	ApiKeyScopeAdmin:  3,
+}
+
+var (
+	insertApiKey = strings.Join([]string{
+		"INSERT INTO mafiyrm.api_keys(",
+		"  tenant_fk,",
+		"  name,",
+		"  hash,",
+		"  scope",
+		")",
+		"VALUES ($1, $2, $3, $4)",
+		"RETURNING id, create_date",
+	}, " ")
+	selectApiKeys = strings.Join([]string{
+		"SELECT",
+		"  id,",
+		"  tenant_fk,",
+		"  name,",
+		"  scope,",
+		"  revoked,",
+		"  last_used_date,",
+		"  create_date",
+		"FROM mafiyrm.api_keys",
+		"ORDER BY create_date",
+	}, " ")
+	revokeApiKey = strings.Join([]string{
+		"UPDATE mafiyrm.api_keys",
+		"SET",
+		"  revoked = TRUE",
+		"WHERE id = $1 AND NOT revoked",
+	}, " ")
+	authenticateApiKey = strings.Join([]string{
+		"UPDATE mafiyrm.api_keys",
+		"SET",
+		"  last_used_date = CURRENT_TIMESTAMP",
+		"WHERE hash = $1 AND NOT revoked",
+		"RETURNING",
+		"  id,",
+		"  tenant_fk,",
+		"  name,",
+		"  scope,",
+		"  revoked,",
+		"  last_used_date,",
+		"  create_date",
+	}, " ")
+)
+
+type ApiKey struct {
+	Id           uuid.UUID  `json:"id"`
+	Tenant       uuid.UUID  `json:"tenant"`
+	Name         string     `json:"name"`
+	Scope        string     `json:"scope"`
+	Revoked      bool       `json:"revoked"`
+	LastUsedDate *time.Time `json:"lastUsedDate,omitempty"`
+	CreateDate   time.Time  `json:"createDate"`
+}
+
+// Allows tells whether the key is granted scope.
+func (apiKey *ApiKey) Allows(scope string) bool {
+	return apiKeyScopes[apiKey.Scope] >= apiKeyScopes[scope]
+}
+
+func IsApiKeyScope(scope string) bool {
+	_, found := apiKeyScopes[scope]
+	return found
+}
+
+// hashApiKey digests a key before it reaches the database. Keys are random
+// and long, so a plain SHA-256 can not be brute forced back to the key.
+func hashApiKey(key string) string {
+	digest := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(digest[:])
+}
+
+// IssueApiKey stores a new key of tenant for scope and returns it, the key
+// itself is only known to the caller and can not be read back afterwards.
+func (model *Model) IssueApiKey(tenant uuid.UUID, name, scope string) (*ApiKey, string, error) {
+	if !IsApiKeyScope(scope) {
+
+		return nil, "", ErrApiKeyScopeInvalid
+	}
+
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+
+		return nil, "", err
+	}
+
+	key := apiKeyPrefix + base64.RawURLEncoding.EncodeToString(random)
+
+	model.logger.Debugf("Issuing %s api key %s", scope, name)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	apiKey := &ApiKey{
+		Tenant: tenant,
+		Name:   name,
+		Scope:  scope,
+	}
+
+	err := model.pool.QueryRow(ctx, insertApiKey, tenant, name, hashApiKey(key), scope).
+		Scan(&apiKey.Id, &apiKey.CreateDate)
+	if isForeignKeyViolation(err) {
+
+		return nil, "", ErrTenantNotFound
+	} else if err != nil {
+
+		return nil, "", err
+	}
+
+	model.logger.Infof("Api key %s issued as %s", name, apiKey.Id)
+	return apiKey, key, nil
+}
+
+func (model *Model) ApiKeys() ([]*ApiKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	rows, err := model.pool.Query(ctx, selectApiKeys)
+	if err != nil {
+
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	apiKeys := []*ApiKey{}
+	for rows.Next() {
+		apiKey, err := scanApiKey(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		apiKeys = append(apiKeys, apiKey)
+	}
+
+	return apiKeys, rows.Err()
+}
+
+func (model *Model) RevokeApiKey(id uuid.UUID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	tag, err := model.pool.Exec(ctx, revokeApiKey, id)
+	if err != nil {
+
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+
+		return ErrApiKeyNotFound
+	}
+
+	model.logger.Infof("Api key %s revoked", id)
+	return nil
+}
+
+// AuthenticateApiKey returns the not revoked key matching key, recording its
+// use, or ErrApiKeyNotFound.
+func (model *Model) AuthenticateApiKey(key string) (*ApiKey, error) {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+
+		return nil, ErrApiKeyNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	apiKey, err := scanApiKey(model.pool.QueryRow(ctx, authenticateApiKey, hashApiKey(key)))
+	if errors.Is(err, pgx.ErrNoRows) {
+
+		return nil, ErrApiKeyNotFound
+	}
+
+	return apiKey, err
+}
+
+func scanApiKey(row pgx.Row) (*ApiKey, error) {
+	apiKey := &ApiKey{}
+	err := row.Scan(&apiKey.Id, &apiKey.Tenant, &apiKey.Name, &apiKey.Scope, &apiKey.Revoked, &apiKey.LastUsedDate, &apiKey.CreateDate)
+	if err != nil {
+		return nil, err
+	}
+
+	return apiKey, nil
+}
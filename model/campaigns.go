@@ -0,0 +1,368 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrCampaignNotFound = errors.New("campaign not found")
+	ErrCampaignExists   = errors.New("campaign already exists")
+)
+
+var (
+	insertCampaign = strings.Join([]string{
+		"INSERT INTO mafiyrm.campaigns(",
+		"  tenant_fk,",
+		"  name,",
+		"  description,",
+		"  start_date,",
+		"  end_date",
+		")",
+		"VALUES ($1, $2, $3, $4, $5)",
+		"RETURNING id, create_date",
+	}, " ")
+	selectCampaigns = strings.Join([]string{
+		"SELECT",
+		"  id,",
+		"  name,",
+		"  description,",
+		"  start_date,",
+		"  end_date,",
+		"  create_date",
+		"FROM mafiyrm.campaigns",
+		"WHERE tenant_fk = $1",
+		"ORDER BY create_date DESC",
+	}, " ")
+	selectCampaign = strings.Join([]string{
+		"SELECT",
+		"  id,",
+		"  name,",
+		"  description,",
+		"  start_date,",
+		"  end_date,",
+		"  create_date",
+		"FROM mafiyrm.campaigns",
+		"WHERE id = $1 AND tenant_fk = $2",
+	}, " ")
+	selectCampaignHourlyStats = strings.Join([]string{
+		"SELECT",
+		"  hourly.bucket,",
+		"  SUM(hourly.fetches)::bigint,",
+		"  SUM(hourly.fetchers)::bigint,",
+		"  SUM(hourly.out_of_window_fetches)::bigint,",
+		"  SUM(hourly.deduplicated_fetches)::bigint,",
+		"  SUM(hourly.head_fetches)::bigint",
+		"FROM mafiyrm.images_accessed_hourly AS hourly",
+		"JOIN mafiyrm.images ON images.id = hourly.image_fk",
+		"WHERE images.campaign_fk = $1",
+		"  AND images.tenant_fk = $4",
+		"  AND hourly.bucket >= $2",
+		"  AND hourly.bucket < $3",
+		"  AND (hourly.fetches > 0 OR hourly.out_of_window_fetches > 0 OR hourly.head_fetches > 0)",
+		"GROUP BY hourly.bucket",
+		"ORDER BY hourly.bucket",
+	}, " ")
+	// Filtered by category, hourly fetchers are still counted per image to
+	// match the rollups.
+	selectCampaignHourlyStatsByCategory = strings.Join([]string{
+		"SELECT",
+		"  bucket,",
+		"  SUM(fetches)::bigint,",
+		"  SUM(fetchers)::bigint,",
+		"  SUM(out_of_window_fetches)::bigint,",
+		"  SUM(deduplicated_fetches)::bigint,",
+		"  SUM(head_fetches)::bigint",
+		"FROM (",
+		"  SELECT",
+		"    date_trunc('hour', accessed.create_date AT TIME ZONE 'UTC') AT TIME ZONE 'UTC' AS bucket,",
+		"    COUNT(*) FILTER (WHERE accessed.method <> 'HEAD' AND NOT accessed.out_of_window) AS fetches,",
+		"    COUNT(DISTINCT accessed.who_fk) FILTER (WHERE accessed.method <> 'HEAD' AND NOT accessed.out_of_window) AS fetchers,",
+		"    COUNT(*) FILTER (WHERE accessed.method <> 'HEAD' AND accessed.out_of_window) AS out_of_window_fetches,",
+		"    COUNT(*) FILTER (WHERE accessed.method <> 'HEAD' AND NOT accessed.out_of_window AND NOT accessed.duplicate) AS deduplicated_fetches,",
+		"    COUNT(*) FILTER (WHERE accessed.method = 'HEAD') AS head_fetches",
+		"  FROM mafiyrm.images_accessed AS accessed",
+		"  JOIN mafiyrm.images ON images.id = accessed.image_fk",
+		"  WHERE images.campaign_fk = $1",
+		"    AND images.tenant_fk = $4",
+		"    AND accessed.create_date >= $2",
+		"    AND accessed.create_date < $3",
+		"    AND COALESCE(accessed.category, '" + unknownCategory + "') = ANY($5)",
+		"  GROUP BY accessed.image_fk, bucket",
+		") AS hourly",
+		"GROUP BY bucket",
+		"ORDER BY bucket",
+	}, " ")
+	selectCampaignClientStats = strings.Join([]string{
+		"SELECT",
+		"  COALESCE(accessed.mail_client, ''),",
+		"  COALESCE(accessed.browser, ''),",
+		"  COALESCE(accessed.os, ''),",
+		"  COALESCE(accessed.device_type, ''),",
+		"  COUNT(*)::bigint,",
+		"  COUNT(*) FILTER (WHERE NOT accessed.duplicate)::bigint,",
+		"  COUNT(DISTINCT accessed.who_fk)::bigint",
+		"FROM mafiyrm.images_accessed AS accessed",
+		"JOIN mafiyrm.images ON images.id = accessed.image_fk",
+		"WHERE images.campaign_fk = $1",
+		"  AND images.tenant_fk = $4",
+		"  AND accessed.create_date >= $2",
+		"  AND accessed.create_date < $3",
+		"  AND accessed.method <> 'HEAD' AND NOT accessed.out_of_window",
+		"  AND ($5::varchar[] IS NULL OR COALESCE(accessed.category, '" + unknownCategory + "') = ANY($5))",
+		"GROUP BY 1, 2, 3, 4",
+		"ORDER BY 5 DESC, 1, 2, 3, 4",
+	}, " ")
+	selectCampaignImagesStats = strings.Join([]string{
+		"SELECT",
+		"  images.id,",
+		"  images.used_in,",
+		"  COALESCE(images.expires_at <= CURRENT_TIMESTAMP, FALSE) AS expired,",
+		"  COALESCE(SUM(hourly.fetches), 0)::bigint,",
+		"  COALESCE(SUM(hourly.out_of_window_fetches), 0)::bigint,",
+		"  COALESCE(SUM(hourly.deduplicated_fetches), 0)::bigint,",
+		"  COALESCE(SUM(hourly.head_fetches), 0)::bigint",
+		"FROM mafiyrm.images",
+		"LEFT JOIN mafiyrm.images_accessed_hourly AS hourly",
+		"  ON hourly.image_fk = images.id",
+		"  AND hourly.bucket >= $2",
+		"  AND hourly.bucket < $3",
+		"WHERE images.campaign_fk = $1",
+		"  AND images.tenant_fk = $4",
+		"GROUP BY images.id, images.used_in, images.expires_at",
+		"ORDER BY images.used_in",
+	}, " ")
+	selectCampaignImagesStatsByCategory = strings.Join([]string{
+		"SELECT",
+		"  images.id,",
+		"  images.used_in,",
+		"  COALESCE(images.expires_at <= CURRENT_TIMESTAMP, FALSE) AS expired,",
+		"  COUNT(accessed.image_fk) FILTER (WHERE accessed.method <> 'HEAD' AND NOT accessed.out_of_window)::bigint,",
+		"  COUNT(accessed.image_fk) FILTER (WHERE accessed.method <> 'HEAD' AND accessed.out_of_window)::bigint,",
+		"  COUNT(accessed.image_fk) FILTER (WHERE accessed.method <> 'HEAD' AND NOT accessed.out_of_window AND NOT accessed.duplicate)::bigint,",
+		"  COUNT(accessed.image_fk) FILTER (WHERE accessed.method = 'HEAD')::bigint",
+		"FROM mafiyrm.images",
+		"LEFT JOIN mafiyrm.images_accessed AS accessed",
+		"  ON accessed.image_fk = images.id",
+		"  AND accessed.create_date >= $2",
+		"  AND accessed.create_date < $3",
+		"  AND COALESCE(accessed.category, '" + unknownCategory + "') = ANY($5)",
+		"WHERE images.campaign_fk = $1",
+		"  AND images.tenant_fk = $4",
+		"GROUP BY images.id, images.used_in, images.expires_at",
+		"ORDER BY images.used_in",
+	}, " ")
+)
+
+type Campaign struct {
+	Id          uuid.UUID  `json:"id"`
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	StartDate   *time.Time `json:"startDate,omitempty"`
+	EndDate     *time.Time `json:"endDate,omitempty"`
+	CreateDate  time.Time  `json:"createDate"`
+}
+
+type CampaignImageStats struct {
+	Image               uuid.UUID `json:"image"`
+	UsedIn              string    `json:"usedIn"`
+	Expired             bool      `json:"expired"`
+	Fetches             int64     `json:"fetches"`
+	OutOfWindowFetches  int64     `json:"outOfWindowFetches"`
+	DeduplicatedFetches int64     `json:"deduplicatedFetches"`
+	HeadFetches         int64     `json:"headFetches"`
+}
+
+// CampaignStats rolls the hourly rollups up across every image of a campaign.
+// Hourly fetchers are summed per image, so a fetcher opening two images of the
+// same campaign within an hour is counted twice.
+type CampaignStats struct {
+	Campaign            uuid.UUID             `json:"campaign"`
+	From                time.Time             `json:"from"`
+	To                  time.Time             `json:"to"`
+	Categories          []string              `json:"categories,omitempty"`
+	Fetches             int64                 `json:"fetches"`
+	OutOfWindowFetches  int64                 `json:"outOfWindowFetches"`
+	DeduplicatedFetches int64                 `json:"deduplicatedFetches"`
+	HeadFetches         int64                 `json:"headFetches"`
+	Images              []*CampaignImageStats `json:"images"`
+	Hourly              []*HourlyStats        `json:"hourly"`
+	Clients             []*ClientStats        `json:"clients,omitempty"`
+}
+
+func (model *Model) CreateCampaign(tenant uuid.UUID, campaign *Campaign) error {
+	model.logger.Debugf("Creating campaign %s", campaign.Name)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	tx, err := model.pool.BeginTx(ctx, *model.txOpts)
+	if err != nil {
+
+		return err
+	}
+
+	defer tx.Rollback(ctx)
+
+	if err := reserveTenantCampaign(ctx, tx, tenant); err != nil {
+		return err
+	}
+
+	err = tx.QueryRow(ctx, insertCampaign, tenant, campaign.Name, campaign.Description, campaign.StartDate, campaign.EndDate).
+		Scan(&campaign.Id, &campaign.CreateDate)
+	if isUniqueViolation(err) {
+
+		return ErrCampaignExists
+	} else if err != nil {
+
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	model.logger.Infof("Campaign %s created as %s", campaign.Name, campaign.Id)
+	return nil
+}
+
+func (model *Model) Campaigns(tenant uuid.UUID) ([]*Campaign, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	rows, err := model.pool.Query(ctx, selectCampaigns, tenant)
+	if err != nil {
+
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	campaigns := []*Campaign{}
+	for rows.Next() {
+		campaign, err := scanCampaign(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		campaigns = append(campaigns, campaign)
+	}
+
+	return campaigns, rows.Err()
+}
+
+func (model *Model) Campaign(tenant, id uuid.UUID) (*Campaign, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	campaign, err := scanCampaign(model.pool.QueryRow(ctx, selectCampaign, id, tenant))
+	if errors.Is(err, pgx.ErrNoRows) {
+
+		return nil, ErrCampaignNotFound
+	}
+
+	return campaign, err
+}
+
+func scanCampaign(row pgx.Row) (*Campaign, error) {
+	campaign := &Campaign{}
+	err := row.Scan(&campaign.Id, &campaign.Name, &campaign.Description, &campaign.StartDate, &campaign.EndDate, &campaign.CreateDate)
+	if err != nil {
+		return nil, err
+	}
+
+	return campaign, nil
+}
+
+func (model *Model) CampaignStats(tenant, id uuid.UUID, filter *StatsFilter) (*CampaignStats, error) {
+	model.logger.Debugf("Reading stats for %s campaign between %s and %s", id, filter.From, filter.To)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	stats := &CampaignStats{
+		Campaign:   id,
+		From:       filter.From,
+		To:         filter.To,
+		Categories: filter.Categories,
+		Images:     []*CampaignImageStats{},
+		Hourly:     []*HourlyStats{},
+	}
+
+	imagesQuery, hourlyQuery := selectCampaignImagesStats, selectCampaignHourlyStats
+	args := []any{id, filter.From, filter.To, tenant}
+	if len(filter.Categories) > 0 {
+		imagesQuery, hourlyQuery = selectCampaignImagesStatsByCategory, selectCampaignHourlyStatsByCategory
+		args = append(args, filter.Categories)
+	}
+
+	imagesRows, err := model.pool.Query(ctx, imagesQuery, args...)
+	if err != nil {
+
+		return nil, err
+	}
+
+	defer imagesRows.Close()
+
+	for imagesRows.Next() {
+		image := &CampaignImageStats{}
+		if err := imagesRows.Scan(&image.Image, &image.UsedIn, &image.Expired, &image.Fetches, &image.OutOfWindowFetches, &image.DeduplicatedFetches, &image.HeadFetches); err != nil {
+			return nil, err
+		}
+
+		stats.Fetches += image.Fetches
+		stats.OutOfWindowFetches += image.OutOfWindowFetches
+		stats.DeduplicatedFetches += image.DeduplicatedFetches
+		stats.HeadFetches += image.HeadFetches
+		stats.Images = append(stats.Images, image)
+	}
+
+	// Released before the next query, the pool may hold a single connection.
+	imagesRows.Close()
+	if err := imagesRows.Err(); err != nil {
+		return nil, err
+	}
+
+	hourlyRows, err := model.pool.Query(ctx, hourlyQuery, args...)
+	if err != nil {
+
+		return nil, err
+	}
+
+	defer hourlyRows.Close()
+
+	for hourlyRows.Next() {
+		hourly := &HourlyStats{}
+		if err := hourlyRows.Scan(&hourly.Bucket, &hourly.Fetches, &hourly.Fetchers, &hourly.OutOfWindowFetches, &hourly.DeduplicatedFetches, &hourly.HeadFetches); err != nil {
+			return nil, err
+		}
+
+		stats.Hourly = append(stats.Hourly, hourly)
+	}
+
+	hourlyRows.Close()
+	if err := hourlyRows.Err(); err != nil {
+		return nil, err
+	}
+
+	if filter.ByClient {
+		clients, err := model.clientStats(ctx, selectCampaignClientStats, id, filter, tenant)
+		if err != nil {
+
+			return nil, err
+		}
+
+		stats.Clients = clients
+	}
+
+	select {
+	case <-ctx.Done():
+		model.logger.Errorf("Reading stats for %s campaign went in error: %s", id, ctx.Err().Error())
+		return nil, ctx.Err()
+	default:
+		return stats, nil
+	}
+}
@@ -0,0 +1,144 @@
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	imagesFetchedChannel   = "mafiyrm_images_fetched"
+	fetchEventsBufferSize  = 64
+	fetchEventsRetryPeriod = 5 * time.Second
+)
+
+var (
+	notifyImageFetched = strings.Join([]string{
+		"SELECT pg_notify(",
+		"  '" + imagesFetchedChannel + "',",
+		"  json_build_object(",
+		"    'image', $1::uuid,",
+		"    'tenant', (SELECT tenant_fk FROM mafiyrm.images WHERE id = $1::uuid),",
+		"    'usedIn', (SELECT used_in FROM mafiyrm.images WHERE id = $1::uuid),",
+		"    'remoteAddr', $2::varchar,",
+		"    'recipient', NULLIF($3::varchar, ''),",
+		"    'outOfWindow', $4::boolean,",
+		"    'category', NULLIF($5::varchar, ''),",
+		"    'date', CURRENT_TIMESTAMP",
+		"  )::text",
+		")",
+	}, " ")
+	listenImagesFetched = "LISTEN " + imagesFetchedChannel
+)
+
+// FetchEvent is a recorded fetch, Tenant is nil for fetches of unknown images.
+type FetchEvent struct {
+	Image       uuid.UUID  `json:"image"`
+	Tenant      *uuid.UUID `json:"tenant,omitempty"`
+	UsedIn      string     `json:"usedIn"`
+	RemoteAddr  string     `json:"remoteAddr"`
+	Recipient   string     `json:"recipient,omitempty"`
+	OutOfWindow bool       `json:"outOfWindow,omitempty"`
+	Category    string     `json:"category,omitempty"`
+	Date        time.Time  `json:"date"`
+}
+
+type fetchEventsBroker struct {
+	sync.Mutex
+	subscribers map[chan *FetchEvent]struct{}
+}
+
+// SubscribeFetchEvents returns a channel receiving every fetch recorded by any
+// replica sharing the database, and the function releasing it.
+func (model *Model) SubscribeFetchEvents() (<-chan *FetchEvent, func()) {
+	events := make(chan *FetchEvent, fetchEventsBufferSize)
+
+	model.fetchEvents.Lock()
+	model.fetchEvents.subscribers[events] = struct{}{}
+	model.fetchEvents.Unlock()
+
+	return events, func() {
+		model.fetchEvents.Lock()
+		delete(model.fetchEvents.subscribers, events)
+		model.fetchEvents.Unlock()
+	}
+}
+
+func (model *Model) publishFetchEvent(event *FetchEvent) {
+	model.fetchEvents.Lock()
+	defer model.fetchEvents.Unlock()
+
+	for subscriber := range model.fetchEvents.subscribers {
+		select {
+		case subscriber <- event:
+		default:
+			model.logger.Warnf("Dropping fetch event of %s for a slow subscriber", event.Image)
+		}
+	}
+}
+
+func (model *Model) waitFetchEvents(ctx context.Context) error {
+	conn, err := pgx.ConnectConfig(ctx, model.pool.Config().ConnConfig)
+	if err != nil {
+
+		return err
+	}
+
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, listenImagesFetched); err != nil {
+		return err
+	}
+
+	model.logger.Debugf("Listening on %s channel", imagesFetchedChannel)
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+
+			return err
+		}
+
+		event := &FetchEvent{}
+		if err := json.Unmarshal([]byte(notification.Payload), event); err != nil {
+			model.logger.Errorf("Fetch event %s is malformed: %s", notification.Payload, err.Error())
+			continue
+		}
+
+		model.publishFetchEvent(event)
+	}
+}
+
+func (model *Model) listenFetchEvents(ctx context.Context) {
+	defer model.background.Done()
+
+	for {
+		err := model.waitFetchEvents(ctx)
+		if ctx.Err() != nil {
+
+			return
+		}
+
+		model.logger.Errorf("Listening fetch events went in error, retrying: %s", err.Error())
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(fetchEventsRetryPeriod):
+		}
+	}
+}
+
+func (model *Model) initFetchEvents() {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	model.fetchEvents = &fetchEventsBroker{
+		subscribers: map[chan *FetchEvent]struct{}{},
+	}
+	model.fetchEventsCancel = cancel
+	model.background.Add(1)
+	go model.listenFetchEvents(ctx)
+}
@@ -0,0 +1,39 @@
+package model
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	markFetchSeen  = "SELECT mafiyrm.mark_fetch_seen($1, $2)"
+	pruneFetchSeen = "SELECT mafiyrm.prune_fetch_dedup($1)"
+)
+
+// MarkFetchSeen records a fetch with fingerprint, shared by every replica,
+// and returns whether another one was recorded within window before it.
+func (model *Model) MarkFetchSeen(fingerprint string, window time.Duration) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var duplicate bool
+	if err := model.pool.QueryRow(ctx, markFetchSeen, fingerprint, window.Seconds()).Scan(&duplicate); err != nil {
+		return false, err
+	}
+
+	return duplicate, nil
+}
+
+// PruneFetchSeen deletes the fingerprints recorded more than idle ago.
+func (model *Model) PruneFetchSeen(idle time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	var pruned int64
+	if err := model.pool.QueryRow(ctx, pruneFetchSeen, idle.Seconds()).Scan(&pruned); err != nil {
+		return err
+	}
+
+	model.logger.Debugf("Pruned %d fetch fingerprints", pruned)
+	return nil
+}
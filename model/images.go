@@ -0,0 +1,290 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrImageNotFound      = errors.New("image not found")
+	ErrImageExists        = errors.New("image already exists")
+	ErrImageWindowInvalid = errors.New("image activity window must start before it expires")
+)
+
+const imageColumns = "" +
+	"  id," +
+	"  used_in," +
+	"  campaign_fk," +
+	"  active_from," +
+	"  expires_at," +
+	"  COALESCE(expires_at <= CURRENT_TIMESTAMP, FALSE) AS expired," +
+	"  disabled," +
+	"  delete_date," +
+	"  last_update_date," +
+	"  create_date"
+
+var (
+	selectImages = strings.Join([]string{
+		"SELECT",
+		imageColumns + ",",
+		"  COUNT(*) OVER () AS total",
+		"FROM mafiyrm.images",
+		"WHERE tenant_fk = $7",
+		"  AND ($1 = '' OR used_in LIKE $1 || '%')",
+		"  AND ($2::timestamptz IS NULL OR create_date >= $2)",
+		"  AND ($3::timestamptz IS NULL OR create_date < $3)",
+		"  AND (delete_date IS NOT NULL) = $4",
+		"ORDER BY create_date DESC, id",
+		"LIMIT $5",
+		"OFFSET $6",
+	}, " ")
+	selectImage = strings.Join([]string{
+		"SELECT",
+		imageColumns,
+		"FROM mafiyrm.images",
+		"WHERE id = $1 AND tenant_fk = $2",
+	}, " ")
+	updateImage = strings.Join([]string{
+		"UPDATE mafiyrm.images",
+		"SET",
+		"  used_in = COALESCE($2, used_in),",
+		"  campaign_fk = CASE WHEN $4 THEN NULL ELSE COALESCE($3, campaign_fk) END,",
+		"  active_from = CASE WHEN $6 THEN NULL ELSE COALESCE($5, active_from) END,",
+		"  expires_at = CASE WHEN $8 THEN NULL ELSE COALESCE($7, expires_at) END,",
+		"  disabled = COALESCE($9, disabled)",
+		"WHERE id = $1 AND tenant_fk = $10 AND delete_date IS NULL",
+		"RETURNING",
+		imageColumns,
+	}, " ")
+	deleteImage = strings.Join([]string{
+		"UPDATE mafiyrm.images",
+		"SET",
+		"  delete_date = CURRENT_TIMESTAMP",
+		"WHERE id = $1 AND tenant_fk = $2 AND delete_date IS NULL",
+	}, " ")
+	lockDeletedImage = strings.Join([]string{
+		"SELECT id",
+		"FROM mafiyrm.images",
+		"WHERE id = $1 AND tenant_fk = $2 AND delete_date IS NOT NULL",
+		"FOR UPDATE",
+	}, " ")
+	restoreImage = strings.Join([]string{
+		"UPDATE mafiyrm.images",
+		"SET",
+		"  delete_date = NULL",
+		"WHERE id = $1 AND tenant_fk = $2 AND delete_date IS NOT NULL",
+		"RETURNING",
+		imageColumns,
+	}, " ")
+)
+
+type Image struct {
+	Id             uuid.UUID  `json:"id"`
+	UsedIn         string     `json:"usedIn"`
+	Campaign       *uuid.UUID `json:"campaign,omitempty"`
+	ActiveFrom     *time.Time `json:"activeFrom,omitempty"`
+	ExpiresAt      *time.Time `json:"expiresAt,omitempty"`
+	Expired        bool       `json:"expired"`
+	Disabled       bool       `json:"disabled"`
+	DeleteDate     *time.Time `json:"deleteDate,omitempty"`
+	LastUpdateDate *time.Time `json:"lastUpdateDate,omitempty"`
+	CreateDate     time.Time  `json:"createDate"`
+}
+
+type ImagesFilter struct {
+	UsedInPrefix string
+	CreatedFrom  *time.Time
+	CreatedTo    *time.Time
+	Deleted      bool
+	Limit        int
+	Offset       int
+}
+
+type ImagesPage struct {
+	Images []*Image `json:"images"`
+	Total  int64    `json:"total"`
+	Limit  int      `json:"limit"`
+	Offset int      `json:"offset"`
+}
+
+// ImageChanges lists the image attributes to change: nil attributes are left
+// untouched, the Clear flags reset the optional ones.
+type ImageChanges struct {
+	UsedIn          *string
+	Campaign        *uuid.UUID
+	ClearCampaign   bool
+	ActiveFrom      *time.Time
+	ClearActiveFrom bool
+	ExpiresAt       *time.Time
+	ClearExpiresAt  bool
+	Disabled        *bool
+}
+
+func scanImage(row pgx.Row, rest ...any) (*Image, error) {
+	image := &Image{}
+	dest := append([]any{
+		&image.Id,
+		&image.UsedIn,
+		&image.Campaign,
+		&image.ActiveFrom,
+		&image.ExpiresAt,
+		&image.Expired,
+		&image.Disabled,
+		&image.DeleteDate,
+		&image.LastUpdateDate,
+		&image.CreateDate,
+	}, rest...)
+
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+
+	return image, nil
+}
+
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
+
+func (model *Model) Images(tenant uuid.UUID, filter *ImagesFilter) (*ImagesPage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	rows, err := model.pool.Query(ctx, selectImages, escapeLike(filter.UsedInPrefix),
+		filter.CreatedFrom, filter.CreatedTo, filter.Deleted, filter.Limit, filter.Offset, tenant)
+	if err != nil {
+
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	page := &ImagesPage{
+		Images: []*Image{},
+		Limit:  filter.Limit,
+		Offset: filter.Offset,
+	}
+	for rows.Next() {
+		image, err := scanImage(rows, &page.Total)
+		if err != nil {
+			return nil, err
+		}
+
+		page.Images = append(page.Images, image)
+	}
+
+	return page, rows.Err()
+}
+
+func (model *Model) Image(tenant, id uuid.UUID) (*Image, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	image, err := scanImage(model.pool.QueryRow(ctx, selectImage, id, tenant))
+	if errors.Is(err, pgx.ErrNoRows) {
+
+		return nil, ErrImageNotFound
+	}
+
+	return image, err
+}
+
+func (model *Model) UpdateImage(tenant, id uuid.UUID, changes *ImageChanges) (*Image, error) {
+	model.logger.Debugf("Updating image %s", id)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	image, err := scanImage(model.pool.QueryRow(ctx, updateImage, id,
+		changes.UsedIn,
+		changes.Campaign, changes.ClearCampaign,
+		changes.ActiveFrom, changes.ClearActiveFrom,
+		changes.ExpiresAt, changes.ClearExpiresAt,
+		changes.Disabled,
+		tenant,
+	))
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return nil, ErrImageNotFound
+	case isUniqueViolation(err):
+		return nil, ErrImageExists
+	case isForeignKeyViolation(err):
+		return nil, ErrCampaignNotFound
+	case isCheckViolation(err):
+		return nil, ErrImageWindowInvalid
+	case err != nil:
+		return nil, err
+	}
+
+	model.logger.Infof("Image %s updated", id)
+	return image, nil
+}
+
+func (model *Model) DeleteImage(tenant, id uuid.UUID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	tag, err := model.pool.Exec(ctx, deleteImage, id, tenant)
+	if err != nil {
+
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+
+		return ErrImageNotFound
+	}
+
+	model.logger.Infof("Image %s deleted", id)
+	return nil
+}
+
+// RestoreImage undeletes the image, which counts again against the tenant
+// images quota.
+func (model *Model) RestoreImage(tenant, id uuid.UUID) (*Image, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	tx, err := model.pool.BeginTx(ctx, *model.txOpts)
+	if err != nil {
+
+		return nil, err
+	}
+
+	defer tx.Rollback(ctx)
+
+	// The image is looked up before the quota, so that images unknown to
+	// the tenant are not found whether its quota is full or not.
+	var locked uuid.UUID
+	err = tx.QueryRow(ctx, lockDeletedImage, id, tenant).Scan(&locked)
+	if errors.Is(err, pgx.ErrNoRows) {
+
+		return nil, ErrImageNotFound
+	} else if err != nil {
+
+		return nil, err
+	}
+
+	if err := reserveTenantImage(ctx, tx, tenant); err != nil {
+		return nil, err
+	}
+
+	image, err := scanImage(tx.QueryRow(ctx, restoreImage, id, tenant))
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return nil, ErrImageNotFound
+	case err != nil:
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	model.logger.Infof("Image %s restored", id)
+	return image, nil
+}
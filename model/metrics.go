@@ -0,0 +1,51 @@
+package model
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var countPendingWebhookDeliveries = strings.Join([]string{
+	"SELECT COUNT(*)",
+	"FROM mafiyrm.webhook_deliveries",
+	"WHERE status = '" + WebhookDeliveryPending + "'",
+}, " ")
+
+// PoolStat returns the statistics of the connection pool.
+func (model *Model) PoolStat() *pgxpool.Stat {
+	return model.pool.Stat()
+}
+
+// MigrationVersion returns the schema migration version applied at startup,
+// and whether it failed half way.
+func (model *Model) MigrationVersion() (uint, bool) {
+	return model.migrationVersion, model.migrationDirty
+}
+
+// FetchEventsQueued returns the fetch events waiting to be sent to the
+// subscribers, summed over all of them.
+func (model *Model) FetchEventsQueued() int {
+	model.fetchEvents.Lock()
+	defer model.fetchEvents.Unlock()
+
+	queued := 0
+	for subscriber := range model.fetchEvents.subscribers {
+		queued += len(subscriber)
+	}
+
+	return queued
+}
+
+// PendingWebhookDeliveries returns the webhook deliveries not delivered nor
+// given up yet.
+func (model *Model) PendingWebhookDeliveries() (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	var pending int64
+	err := model.pool.QueryRow(ctx, countPendingWebhookDeliveries).Scan(&pending)
+	return pending, err
+}
@@ -5,9 +5,12 @@ import (
 	"embed"
 	"encoding/json"
 	"errors"
+	"fetch-me-if-you-read-me/geoip"
+	"fetch-me-if-you-read-me/useragent"
 	"fmt"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	migrate "github.com/golang-migrate/migrate/v4"
@@ -17,6 +20,7 @@ import (
 	"go.uber.org/zap"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 
 	logging "fetch-me-if-you-read-me/logger"
@@ -28,16 +32,31 @@ var migrations embed.FS
 var (
 	insertImage = strings.Join([]string{
 		"INSERT INTO mafiyrm.images(",
-		"  used_in",
+		"  tenant_fk,",
+		"  used_in,",
+		"  campaign_fk,",
+		"  active_from,",
+		"  expires_at",
 		")",
-		"VALUES ($1)",
+		"VALUES ($1, $2, $3, $4, $5)",
 		"ON CONFLICT ON CONSTRAINT images_pkey",
 		"DO UPDATE",
 		"SET",
-		"  last_update_date = CURRENT_TIMESTAMP",
-		"WHERE images.used_in = $1",
+		"  last_update_date = CURRENT_TIMESTAMP,",
+		"  campaign_fk = COALESCE(EXCLUDED.campaign_fk, images.campaign_fk),",
+		"  active_from = COALESCE(EXCLUDED.active_from, images.active_from),",
+		"  expires_at = COALESCE(EXCLUDED.expires_at, images.expires_at),",
+		"  delete_date = NULL",
+		"WHERE images.used_in = $2",
 		"RETURNING id::varchar AS image_fk",
 	}, " ")
+	selectImageLive = strings.Join([]string{
+		"SELECT EXISTS (",
+		"  SELECT 1",
+		"  FROM mafiyrm.images",
+		"  WHERE tenant_fk = $1 AND used_in = $2 AND delete_date IS NULL",
+		")",
+	}, " ")
 	insertWhoIsFetching = strings.Join([]string{
 		"INSERT INTO mafiyrm.who(",
 		"  remote_addr,",
@@ -54,9 +73,37 @@ var (
 	boundWhoIsFetchingWithImage = strings.Join([]string{
 		"INSERT INTO mafiyrm.images_accessed(",
 		"  image_fk,",
-		"  who_fk",
+		"  who_fk,",
+		"  recipient,",
+		"  out_of_window,",
+		"  category,",
+		"  browser,",
+		"  browser_version,",
+		"  os,",
+		"  device_type,",
+		"  mail_client,",
+		"  country,",
+		"  city,",
+		"  asn,",
+		"  as_organization,",
+		"  duplicate,",
+		"  method,",
+		"  attributes",
+		")",
+		"VALUES (",
+		"  $1, $2, NULLIF($3, ''), $4, NULLIF($5, ''),",
+		"  NULLIF($6, ''), NULLIF($7, ''), NULLIF($8, ''), NULLIF($9, ''), NULLIF($10, ''),",
+		"  NULLIF($11, ''), NULLIF($12, ''), NULLIF($13::bigint, 0), NULLIF($14, ''), $15,",
+		"  COALESCE(NULLIF($16, ''), 'GET'), $17::jsonb",
 		")",
-		"VALUES ($1, $2)",
+	}, " ")
+	selectImageRecording = strings.Join([]string{
+		"SELECT",
+		"  NOT disabled AND delete_date IS NULL AS recordable,",
+		"  (active_from IS NULL OR active_from <= CURRENT_TIMESTAMP)",
+		"  AND (expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP) AS in_window",
+		"FROM mafiyrm.images",
+		"WHERE id = $1",
 	}, " ")
 )
 
@@ -71,6 +118,10 @@ type PostgresqlConfigurations struct {
 	ApplicationName       string
 	Schema                *string
 	MigrationTable        *string
+	PartitionsAhead       *int
+	PartitionsRetention   *int
+	PartitionsDrop        *bool
+	RollupsInterval       *time.Duration
 }
 
 type Model struct {
@@ -78,18 +129,74 @@ type Model struct {
 	keepAliveTicker *time.Ticker
 	keepAliveDone   chan bool
 
+	partitionsTicker *time.Ticker
+	partitionsDone   chan bool
+	rollupsTicker    *time.Ticker
+	rollupsDone      chan bool
+	prunesTicker     *time.Ticker
+	prunesDone       chan bool
+	prunes           prunes
+
+	fetchEvents       *fetchEventsBroker
+	fetchEventsCancel context.CancelFunc
+
+	// background tracks the maintenance goroutines, Dispose waits for them
+	// before closing the pool.
+	background  sync.WaitGroup
+	disposeOnce sync.Once
+
+	migrationVersion uint
+	migrationDirty   bool
+
 	connectionString         string
 	postgresqlConfigurations *PostgresqlConfigurations
 	pool                     *pgxpool.Pool
 	txOpts                   *pgx.TxOptions
 }
 
-func (model *Model) ImageFetched(imageFk uuid.UUID, remoteAddr string, meta map[string]string) error {
-	model.logger.Debugf("Storing %s remote address for %s imageFk", remoteAddr, imageFk)
-	metaJSON, err := json.Marshal(meta)
+// ImageFetch is a single fetch of an image pixel, as seen by the server.
+// Fetches outside the image activity window are recorded as out of window,
+// or not recorded at all when SkipOutOfWindow is set. Category tells who is
+// likely behind the fetch, such as a reader or a mail proxy, Client what its
+// user agent tells about it and Location where its address is. Duplicate is
+// set for the fetches repeating a recent one of the same client. Method is
+// the request one, and Attributes the JSON object a beacon may post.
+type ImageFetch struct {
+	Image           uuid.UUID
+	RemoteAddr      string
+	Meta            map[string]string
+	Recipient       string
+	Category        string
+	Client          useragent.Client
+	Location        geoip.Location
+	Duplicate       bool
+	Method          string
+	Attributes      json.RawMessage
+	SkipOutOfWindow bool
+}
+
+// Reasons a fetch is not stored for.
+const (
+	FetchSkippedNotRecordable = "not-recordable"
+	FetchSkippedOutOfWindow   = "out-of-window"
+)
+
+type ImageDefinition struct {
+	UsedIn     string
+	Campaign   *uuid.UUID
+	ActiveFrom *time.Time
+	ExpiresAt  *time.Time
+}
+
+// ImageFetched stores fetch, unless its image is not recordable or it is out
+// of window and skipped: the reason it is skipped for is returned then,
+// FetchSkippedNotRecordable or FetchSkippedOutOfWindow.
+func (model *Model) ImageFetched(fetch *ImageFetch) (string, error) {
+	model.logger.Debugf("Storing %s remote address for %s imageFk", fetch.RemoteAddr, fetch.Image)
+	metaJSON, err := json.Marshal(fetch.Meta)
 	if err != nil {
 
-		return err
+		return "", err
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
@@ -98,34 +205,76 @@ func (model *Model) ImageFetched(imageFk uuid.UUID, remoteAddr string, meta map[
 	tx, err := model.pool.BeginTx(ctx, *model.txOpts)
 	if err != nil {
 
-		return err
+		return "", err
 	}
 
 	defer tx.Rollback(ctx)
 
+	recordable, inWindow := true, true
+	err = tx.QueryRow(ctx, selectImageRecording, fetch.Image).Scan(&recordable, &inWindow)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+
+		return "", err
+	}
+
+	if !recordable {
+		model.logger.Debugf("Skipping image %s fetch from %s, the image is disabled or deleted", fetch.Image, fetch.RemoteAddr)
+		return FetchSkippedNotRecordable, nil
+	}
+
+	if !inWindow && fetch.SkipOutOfWindow {
+		model.logger.Debugf("Skipping image %s fetch from %s out of its activity window", fetch.Image, fetch.RemoteAddr)
+		return FetchSkippedOutOfWindow, nil
+	}
+
 	var whoFk string
-	if err := tx.QueryRow(ctx, insertWhoIsFetching, remoteAddr, metaJSON).Scan(&whoFk); err != nil {
-		return err
+	if err := tx.QueryRow(ctx, insertWhoIsFetching, fetch.RemoteAddr, metaJSON).Scan(&whoFk); err != nil {
+		return "", err
 	}
 
-	if _, err := tx.Exec(ctx, boundWhoIsFetchingWithImage, imageFk, whoFk); err != nil {
-		return err
+	// HEAD fetches and duplicates are stored, but they are not opens to
+	// notify about.
+	opened := fetch.Method != http.MethodHead && !fetch.Duplicate
+	if inWindow && opened {
+		if err := enqueueWebhooks(ctx, tx, fetch); err != nil {
+			return "", err
+		}
 	}
 
-	tx.Commit(ctx)
+	if _, err := tx.Exec(ctx, boundWhoIsFetchingWithImage, fetch.Image, whoFk, fetch.Recipient, !inWindow, fetch.Category,
+		fetch.Client.Browser, fetch.Client.Version, fetch.Client.Os, fetch.Client.Device, fetch.Client.MailClient,
+		fetch.Location.Country, fetch.Location.City, int64(fetch.Location.Asn), fetch.Location.Organization,
+		fetch.Duplicate, fetch.Method, []byte(fetch.Attributes)); err != nil {
+		return "", err
+	}
+
+	if opened {
+		if _, err := tx.Exec(ctx, notifyImageFetched, fetch.Image, fetch.RemoteAddr, fetch.Recipient, !inWindow, fetch.Category); err != nil {
+			return "", err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+
+		return "", err
+	}
 
 	select {
 	case <-ctx.Done():
-		model.logger.Errorf("Registering image %s fetch from %s went in error: %s", imageFk, remoteAddr, ctx.Err().Error())
-		return ctx.Err()
+		model.logger.Errorf("Registering image %s fetch from %s went in error: %s", fetch.Image, fetch.RemoteAddr, ctx.Err().Error())
+		return "", ctx.Err()
 	default:
-		model.logger.Infof("Registering image %s fetch from %s done", imageFk, remoteAddr)
+		model.logger.Infof("Registering image %s fetch from %s done", fetch.Image, fetch.RemoteAddr)
 
-		return nil
+		return "", nil
 	}
 }
 
-func (model *Model) PrepareImage(usedIn string) (*uuid.UUID, error) {
+// PrepareImage creates the image used in definition.UsedIn for tenant, or
+// updates it when the tenant already has one. Only new images, deleted ones
+// among them, count against the tenant images quota.
+func (model *Model) PrepareImage(tenant uuid.UUID, definition *ImageDefinition) (*uuid.UUID, error) {
+	usedIn := definition.UsedIn
 	model.logger.Debugf("Creating image reference used in %s", usedIn)
 	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
 	defer cancel()
@@ -138,8 +287,25 @@ func (model *Model) PrepareImage(usedIn string) (*uuid.UUID, error) {
 
 	defer tx.Rollback(ctx)
 
+	var live bool
+	if err := tx.QueryRow(ctx, selectImageLive, tenant, usedIn).Scan(&live); err != nil {
+		return nil, err
+	}
+
+	if !live {
+		if err := reserveTenantImage(ctx, tx, tenant); err != nil {
+			return nil, err
+		}
+	}
+
 	var imageFk string
-	if err := tx.QueryRow(ctx, insertImage, usedIn).Scan(&imageFk); err != nil {
+	if err := tx.QueryRow(ctx, insertImage, tenant, usedIn, definition.Campaign, definition.ActiveFrom, definition.ExpiresAt).Scan(&imageFk); err != nil {
+		if isForeignKeyViolation(err) {
+			return nil, ErrCampaignNotFound
+		}
+		if isCheckViolation(err) {
+			return nil, ErrImageWindowInvalid
+		}
 		return nil, err
 	}
 
@@ -160,9 +326,26 @@ func (model *Model) PrepareImage(usedIn string) (*uuid.UUID, error) {
 	}
 }
 
+// Dispose stops the maintenance goroutines, lets the runs in progress end and
+// closes the pool. It is safe to call it more than once.
 func (model *Model) Dispose() {
-	model.keepAliveDone <- true
-	model.keepAliveTicker.Stop()
+	model.disposeOnce.Do(func() {
+		// Closing rather than sending on the done channels, a goroutine in
+		// the middle of a run is not waiting on them.
+		close(model.keepAliveDone)
+		model.keepAliveTicker.Stop()
+		close(model.partitionsDone)
+		model.partitionsTicker.Stop()
+		close(model.rollupsDone)
+		model.rollupsTicker.Stop()
+		close(model.prunesDone)
+		model.prunesTicker.Stop()
+		model.fetchEventsCancel()
+
+		model.background.Wait()
+		model.pool.Close()
+		model.logger.Info("Model disposed")
+	})
 }
 
 func New(logger *logging.Logger, postgresqlConfigurations *PostgresqlConfigurations) (*Model, error) {
@@ -202,6 +385,14 @@ func New(logger *logging.Logger, postgresqlConfigurations *PostgresqlConfigurati
 		return nil, err
 	}
 
+	if err := toReturn.initPartitions(); err != nil {
+		return nil, err
+	}
+
+	toReturn.initRollups()
+	toReturn.initPrunes()
+	toReturn.initFetchEvents()
+
 	select {
 	case <-ctx.Done():
 		logger.Log.Errorf("Model initialization went in error: %s", ctx.Err().Error())
@@ -213,6 +404,21 @@ func New(logger *logging.Logger, postgresqlConfigurations *PostgresqlConfigurati
 	}
 }
 
+func isForeignKeyViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23503"
+}
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+func isCheckViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23514"
+}
+
 func setupDatabase(username, password, database, schema string) (string, error) {
 
 	//TODO sanitize
@@ -309,6 +515,11 @@ func (m *Model) migrate(ctx context.Context) error {
 		return err
 	}
 
+	m.migrationVersion, m.migrationDirty, err = migrator.Version()
+	if err != nil {
+		return err
+	}
+
 	sourceErr, databaseErr := migrator.Close()
 	if sourceErr != nil {
 		return sourceErr
@@ -342,6 +553,8 @@ func (model *Model) CheckStatus() error {
 }
 
 func (model *Model) keepAlive() {
+	defer model.background.Done()
+
 	for {
 		select {
 		case <-model.keepAliveDone:
@@ -366,6 +579,7 @@ func (model *Model) initPool(ctx context.Context) error {
 	model.pool = pool
 	model.keepAliveTicker = time.NewTicker(time.Minute)
 	model.keepAliveDone = make(chan bool)
+	model.background.Add(1)
 	go model.keepAlive()
 	return nil
 }
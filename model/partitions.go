@@ -0,0 +1,111 @@
+package model
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+var (
+	createImagesAccessedPartitions = strings.Join([]string{
+		"SELECT partition_name",
+		"FROM mafiyrm.create_images_accessed_partitions($1) AS partition_name",
+	}, " ")
+	retireImagesAccessedPartitions = strings.Join([]string{
+		"SELECT partition_name",
+		"FROM mafiyrm.retire_images_accessed_partitions($1, $2) AS partition_name",
+	}, " ")
+)
+
+func (model *Model) MaintainPartitions() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	created, err := model.collectPartitions(ctx, createImagesAccessedPartitions, *model.postgresqlConfigurations.PartitionsAhead)
+	if err != nil {
+
+		return err
+	}
+
+	for _, partition := range created {
+		model.logger.Infof("Partition %s created", partition)
+	}
+
+	if *model.postgresqlConfigurations.PartitionsRetention > 0 {
+		retired, err := model.collectPartitions(ctx, retireImagesAccessedPartitions,
+			*model.postgresqlConfigurations.PartitionsRetention, *model.postgresqlConfigurations.PartitionsDrop)
+		if err != nil {
+
+			return err
+		}
+
+		for _, partition := range retired {
+			if *model.postgresqlConfigurations.PartitionsDrop {
+				model.logger.Infof("Partition %s dropped", partition)
+			} else {
+				model.logger.Infof("Partition %s detached", partition)
+			}
+		}
+	}
+
+	select {
+	case <-ctx.Done():
+		model.logger.Errorf("Partitions maintenance went in error: %s", ctx.Err().Error())
+		return ctx.Err()
+	default:
+		model.logger.Debug("Partitions maintenance done")
+		return nil
+	}
+}
+
+func (model *Model) collectPartitions(ctx context.Context, query string, args ...any) ([]string, error) {
+	rows, err := model.pool.Query(ctx, query, args...)
+	if err != nil {
+
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	partitions := []string{}
+	for rows.Next() {
+		var partition string
+		if err := rows.Scan(&partition); err != nil {
+			return nil, err
+		}
+
+		partitions = append(partitions, partition)
+	}
+
+	return partitions, rows.Err()
+}
+
+func (model *Model) partitionsMaintenance() {
+	defer model.background.Done()
+
+	for {
+		select {
+		case <-model.partitionsDone:
+			return
+		case _ = <-model.partitionsTicker.C:
+			err := model.MaintainPartitions()
+
+			if err != nil {
+
+				model.logger.Errorf("Partitions maintenance failed: %s", err.Error())
+			}
+		}
+	}
+}
+
+func (model *Model) initPartitions() error {
+	if err := model.MaintainPartitions(); err != nil {
+		return err
+	}
+
+	model.partitionsTicker = time.NewTicker(time.Hour)
+	model.partitionsDone = make(chan bool)
+	model.background.Add(1)
+	go model.partitionsMaintenance()
+	return nil
+}
@@ -0,0 +1,93 @@
+package model
+
+import (
+	"sync"
+	"time"
+)
+
+// prunesCheckPeriod is how often the scheduled prunes are checked for being
+// due.
+const prunesCheckPeriod = time.Minute
+
+// prune deletes the rows of a table shared among the replicas once they are
+// of no use anymore, every interval.
+type prune struct {
+	name     string
+	interval time.Duration
+	run      func() error
+	lastRun  time.Time
+}
+
+type prunes struct {
+	sync.Mutex
+	scheduled []*prune
+}
+
+// ScheduleRateLimitsPrune prunes the rate limit buckets starting with prefix
+// left untouched for idle from the maintenance goroutine, every ten idle
+// periods.
+func (model *Model) ScheduleRateLimitsPrune(prefix string, idle time.Duration) {
+	model.schedulePrune("rate limits "+prefix, 10*idle, func() error {
+		return model.PruneRateLimits(prefix, idle)
+	})
+}
+
+// ScheduleFetchSeenPrune prunes the fetch fingerprints recorded more than
+// idle ago from the maintenance goroutine, every ten idle periods.
+func (model *Model) ScheduleFetchSeenPrune(idle time.Duration) {
+	model.schedulePrune("fetch fingerprints", 10*idle, func() error {
+		return model.PruneFetchSeen(idle)
+	})
+}
+
+func (model *Model) schedulePrune(name string, interval time.Duration, run func() error) {
+	model.prunes.Lock()
+	defer model.prunes.Unlock()
+
+	model.prunes.scheduled = append(model.prunes.scheduled, &prune{
+		name:     name,
+		interval: interval,
+		run:      run,
+		lastRun:  time.Now(),
+	})
+}
+
+// runPrunes runs the prunes whose interval elapsed since their last run.
+func (model *Model) runPrunes(now time.Time) {
+	model.prunes.Lock()
+	var due []*prune
+	for _, scheduled := range model.prunes.scheduled {
+		if now.Sub(scheduled.lastRun) >= scheduled.interval {
+			scheduled.lastRun = now
+			due = append(due, scheduled)
+		}
+	}
+	model.prunes.Unlock()
+
+	for _, scheduled := range due {
+		if err := scheduled.run(); err != nil {
+
+			model.logger.Errorf("Pruning %s went in error: %s", scheduled.name, err.Error())
+		}
+	}
+}
+
+func (model *Model) prunesMaintenance() {
+	defer model.background.Done()
+
+	for {
+		select {
+		case <-model.prunesDone:
+			return
+		case now := <-model.prunesTicker.C:
+			model.runPrunes(now)
+		}
+	}
+}
+
+func (model *Model) initPrunes() {
+	model.prunesTicker = time.NewTicker(prunesCheckPeriod)
+	model.prunesDone = make(chan bool)
+	model.background.Add(1)
+	go model.prunesMaintenance()
+}
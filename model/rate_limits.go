@@ -0,0 +1,41 @@
+package model
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	takeRateLimitToken = "SELECT mafiyrm.take_rate_limit_token($1, $2, $3)"
+	pruneRateLimits    = "SELECT mafiyrm.prune_rate_limits($1, $2)"
+)
+
+// TakeRateLimitToken takes a token from bucket, shared by every replica, and
+// returns zero or how long to wait for the next token when there is none.
+func (model *Model) TakeRateLimitToken(bucket string, capacity, perSecond float64) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var wait float64
+	if err := model.pool.QueryRow(ctx, takeRateLimitToken, bucket, capacity, perSecond).Scan(&wait); err != nil {
+		return 0, err
+	}
+
+	return time.Duration(wait * float64(time.Second)), nil
+}
+
+// PruneRateLimits deletes the buckets starting with prefix left untouched for
+// idle, they are full again by then and are recreated as such on their next
+// use. The prefix must not hold LIKE wildcards.
+func (model *Model) PruneRateLimits(prefix string, idle time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	var pruned int64
+	if err := model.pool.QueryRow(ctx, pruneRateLimits, prefix, idle.Seconds()).Scan(&pruned); err != nil {
+		return err
+	}
+
+	model.logger.Debugf("Pruned %d rate limit buckets", pruned)
+	return nil
+}
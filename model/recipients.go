@@ -0,0 +1,61 @@
+package model
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	selectImageRecipients = strings.Join([]string{
+		"SELECT",
+		"  recipient,",
+		"  COUNT(*) AS fetches,",
+		"  MIN(create_date) AS first_fetch_date,",
+		"  MAX(create_date) AS last_fetch_date",
+		"FROM mafiyrm.images_accessed",
+		"WHERE image_fk = $1",
+		"  AND recipient IS NOT NULL",
+		"  AND method <> 'HEAD'",
+		"  AND create_date >= $2",
+		"  AND create_date < $3",
+		"  AND EXISTS (SELECT 1 FROM mafiyrm.images WHERE id = $1 AND tenant_fk = $4)",
+		"GROUP BY recipient",
+		"ORDER BY recipient",
+	}, " ")
+)
+
+type RecipientStats struct {
+	Recipient      string    `json:"recipient"`
+	Fetches        int64     `json:"fetches"`
+	FirstFetchDate time.Time `json:"firstFetchDate"`
+	LastFetchDate  time.Time `json:"lastFetchDate"`
+}
+
+func (model *Model) ImageRecipients(tenant, imageFk uuid.UUID, from, to time.Time) ([]*RecipientStats, error) {
+	model.logger.Debugf("Reading recipients for %s imageFk between %s and %s", imageFk, from, to)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	rows, err := model.pool.Query(ctx, selectImageRecipients, imageFk, from, to, tenant)
+	if err != nil {
+
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	recipients := []*RecipientStats{}
+	for rows.Next() {
+		recipient := &RecipientStats{}
+		if err := rows.Scan(&recipient.Recipient, &recipient.Fetches, &recipient.FirstFetchDate, &recipient.LastFetchDate); err != nil {
+			return nil, err
+		}
+
+		recipients = append(recipients, recipient)
+	}
+
+	return recipients, rows.Err()
+}
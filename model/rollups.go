@@ -0,0 +1,415 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// unknownCategory is the category filtered stats count the fetches recorded
+// before fetches were classified in.
+const unknownCategory = "unknown"
+
+var (
+	refreshRollups = strings.Join([]string{
+		"INSERT INTO mafiyrm.images_accessed_hourly(",
+		"  image_fk,",
+		"  bucket,",
+		"  fetches,",
+		"  fetchers,",
+		"  out_of_window_fetches,",
+		"  deduplicated_fetches,",
+		"  head_fetches",
+		")",
+		"SELECT",
+		"  image_fk,",
+		"  date_trunc('hour', create_date AT TIME ZONE 'UTC') AT TIME ZONE 'UTC' AS bucket,",
+		"  COUNT(*) FILTER (WHERE method <> 'HEAD' AND NOT out_of_window) AS fetches,",
+		"  COUNT(DISTINCT who_fk) FILTER (WHERE method <> 'HEAD' AND NOT out_of_window) AS fetchers,",
+		"  COUNT(*) FILTER (WHERE method <> 'HEAD' AND out_of_window) AS out_of_window_fetches,",
+		"  COUNT(*) FILTER (WHERE method <> 'HEAD' AND NOT out_of_window AND NOT duplicate) AS deduplicated_fetches,",
+		"  COUNT(*) FILTER (WHERE method = 'HEAD') AS head_fetches",
+		"FROM mafiyrm.images_accessed",
+		"WHERE create_date >= (",
+		"  SELECT COALESCE(MAX(bucket) - INTERVAL '1 hour', '-infinity'::timestamptz)",
+		"  FROM mafiyrm.images_accessed_hourly",
+		")",
+		"GROUP BY image_fk, bucket",
+		"ON CONFLICT ON CONSTRAINT images_accessed_hourly_pkey",
+		"DO UPDATE",
+		"SET",
+		"  fetches = EXCLUDED.fetches,",
+		"  fetchers = EXCLUDED.fetchers,",
+		"  out_of_window_fetches = EXCLUDED.out_of_window_fetches,",
+		"  deduplicated_fetches = EXCLUDED.deduplicated_fetches,",
+		"  head_fetches = EXCLUDED.head_fetches",
+	}, " ")
+	resetRollupsBetween = strings.Join([]string{
+		"UPDATE mafiyrm.images_accessed_hourly",
+		"SET",
+		"  fetches = 0,",
+		"  fetchers = 0,",
+		"  out_of_window_fetches = 0,",
+		"  deduplicated_fetches = 0,",
+		"  head_fetches = 0",
+		"WHERE bucket >= $1 AND bucket < $2",
+	}, " ")
+	rebuildRollupsBetween = strings.Join([]string{
+		"INSERT INTO mafiyrm.images_accessed_hourly(",
+		"  image_fk,",
+		"  bucket,",
+		"  fetches,",
+		"  fetchers,",
+		"  out_of_window_fetches,",
+		"  deduplicated_fetches,",
+		"  head_fetches",
+		")",
+		"SELECT",
+		"  image_fk,",
+		"  date_trunc('hour', create_date AT TIME ZONE 'UTC') AT TIME ZONE 'UTC' AS bucket,",
+		"  COUNT(*) FILTER (WHERE method <> 'HEAD' AND NOT out_of_window) AS fetches,",
+		"  COUNT(DISTINCT who_fk) FILTER (WHERE method <> 'HEAD' AND NOT out_of_window) AS fetchers,",
+		"  COUNT(*) FILTER (WHERE method <> 'HEAD' AND out_of_window) AS out_of_window_fetches,",
+		"  COUNT(*) FILTER (WHERE method <> 'HEAD' AND NOT out_of_window AND NOT duplicate) AS deduplicated_fetches,",
+		"  COUNT(*) FILTER (WHERE method = 'HEAD') AS head_fetches",
+		"FROM mafiyrm.images_accessed",
+		"WHERE create_date >= $1 AND create_date < $2",
+		"GROUP BY image_fk, bucket",
+		"ON CONFLICT ON CONSTRAINT images_accessed_hourly_pkey",
+		"DO UPDATE",
+		"SET",
+		"  fetches = EXCLUDED.fetches,",
+		"  fetchers = EXCLUDED.fetchers,",
+		"  out_of_window_fetches = EXCLUDED.out_of_window_fetches,",
+		"  deduplicated_fetches = EXCLUDED.deduplicated_fetches,",
+		"  head_fetches = EXCLUDED.head_fetches",
+	}, " ")
+	oldestImageAccess = strings.Join([]string{
+		"SELECT MIN(create_date)",
+		"FROM mafiyrm.images_accessed",
+	}, " ")
+	selectImageHourlyStats = strings.Join([]string{
+		"SELECT",
+		"  bucket,",
+		"  fetches,",
+		"  fetchers,",
+		"  out_of_window_fetches,",
+		"  deduplicated_fetches,",
+		"  head_fetches",
+		"FROM mafiyrm.images_accessed_hourly",
+		"WHERE image_fk = $1",
+		"  AND bucket >= $2",
+		"  AND bucket < $3",
+		"  AND (fetches > 0 OR out_of_window_fetches > 0 OR head_fetches > 0)",
+		"  AND EXISTS (SELECT 1 FROM mafiyrm.images WHERE id = $1 AND tenant_fk = $4)",
+		"ORDER BY bucket",
+	}, " ")
+	selectImageHourlyStatsByCategory = strings.Join([]string{
+		"SELECT",
+		"  date_trunc('hour', create_date AT TIME ZONE 'UTC') AT TIME ZONE 'UTC' AS bucket,",
+		"  COUNT(*) FILTER (WHERE method <> 'HEAD' AND NOT out_of_window) AS fetches,",
+		"  COUNT(DISTINCT who_fk) FILTER (WHERE method <> 'HEAD' AND NOT out_of_window) AS fetchers,",
+		"  COUNT(*) FILTER (WHERE method <> 'HEAD' AND out_of_window) AS out_of_window_fetches,",
+		"  COUNT(*) FILTER (WHERE method <> 'HEAD' AND NOT out_of_window AND NOT duplicate) AS deduplicated_fetches,",
+		"  COUNT(*) FILTER (WHERE method = 'HEAD') AS head_fetches",
+		"FROM mafiyrm.images_accessed",
+		"WHERE image_fk = $1",
+		"  AND create_date >= $2",
+		"  AND create_date < $3",
+		"  AND COALESCE(category, '" + unknownCategory + "') = ANY($5)",
+		"  AND EXISTS (SELECT 1 FROM mafiyrm.images WHERE id = $1 AND tenant_fk = $4)",
+		"GROUP BY bucket",
+		"ORDER BY bucket",
+	}, " ")
+	// Categories are matched only when $5 is not null, clients are read from
+	// the recorded fetches as rollups do not keep them.
+	selectImageClientStats = strings.Join([]string{
+		"SELECT",
+		"  COALESCE(mail_client, ''),",
+		"  COALESCE(browser, ''),",
+		"  COALESCE(os, ''),",
+		"  COALESCE(device_type, ''),",
+		"  COUNT(*)::bigint,",
+		"  COUNT(*) FILTER (WHERE NOT duplicate)::bigint,",
+		"  COUNT(DISTINCT who_fk)::bigint",
+		"FROM mafiyrm.images_accessed",
+		"WHERE image_fk = $1",
+		"  AND create_date >= $2",
+		"  AND create_date < $3",
+		"  AND method <> 'HEAD' AND NOT out_of_window",
+		"  AND ($5::varchar[] IS NULL OR COALESCE(category, '" + unknownCategory + "') = ANY($5))",
+		"  AND EXISTS (SELECT 1 FROM mafiyrm.images WHERE id = $1 AND tenant_fk = $4)",
+		"GROUP BY 1, 2, 3, 4",
+		"ORDER BY 5 DESC, 1, 2, 3, 4",
+	}, " ")
+	selectImageWindow = strings.Join([]string{
+		"SELECT",
+		"  active_from,",
+		"  expires_at,",
+		"  COALESCE(expires_at <= CURRENT_TIMESTAMP, FALSE) AS expired",
+		"FROM mafiyrm.images",
+		"WHERE id = $1 AND tenant_fk = $2",
+	}, " ")
+)
+
+// HourlyStats counts in-window fetches and fetchers, fetches recorded outside
+// the image activity window are only counted in OutOfWindowFetches.
+// DeduplicatedFetches leaves out the fetches marked as duplicates. HEAD
+// fetches are only counted in HeadFetches.
+type HourlyStats struct {
+	Bucket              time.Time `json:"bucket"`
+	Fetches             int64     `json:"fetches"`
+	Fetchers            int64     `json:"fetchers"`
+	OutOfWindowFetches  int64     `json:"outOfWindowFetches"`
+	DeduplicatedFetches int64     `json:"deduplicatedFetches"`
+	HeadFetches         int64     `json:"headFetches"`
+}
+
+// ClientStats counts in-window fetches and fetchers of the clients sharing a
+// mail client, browser, operating system and device type.
+type ClientStats struct {
+	MailClient          string `json:"mailClient,omitempty"`
+	Browser             string `json:"browser,omitempty"`
+	Os                  string `json:"os,omitempty"`
+	Device              string `json:"device,omitempty"`
+	Fetches             int64  `json:"fetches"`
+	DeduplicatedFetches int64  `json:"deduplicatedFetches"`
+	Fetchers            int64  `json:"fetchers"`
+}
+
+// StatsFilter bounds stats to the fetches between From and To, of one of
+// Categories when there are any. Rollups do not keep categories, so filtered
+// stats are read from the recorded fetches instead. ByClient adds the break
+// down of the fetches by client.
+type StatsFilter struct {
+	From       time.Time
+	To         time.Time
+	Categories []string
+	ByClient   bool
+}
+
+type ImageStats struct {
+	Image               uuid.UUID      `json:"image"`
+	ActiveFrom          *time.Time     `json:"activeFrom,omitempty"`
+	ExpiresAt           *time.Time     `json:"expiresAt,omitempty"`
+	Expired             bool           `json:"expired"`
+	From                time.Time      `json:"from"`
+	To                  time.Time      `json:"to"`
+	Categories          []string       `json:"categories,omitempty"`
+	Fetches             int64          `json:"fetches"`
+	OutOfWindowFetches  int64          `json:"outOfWindowFetches"`
+	DeduplicatedFetches int64          `json:"deduplicatedFetches"`
+	HeadFetches         int64          `json:"headFetches"`
+	Hourly              []*HourlyStats `json:"hourly"`
+	Clients             []*ClientStats `json:"clients,omitempty"`
+}
+
+// ImageStats reads the stats of an image of tenant, images of other tenants
+// have no stats, just like unknown ones.
+func (model *Model) ImageStats(tenant, imageFk uuid.UUID, filter *StatsFilter) (*ImageStats, error) {
+	model.logger.Debugf("Reading stats for %s imageFk between %s and %s", imageFk, filter.From, filter.To)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	stats := &ImageStats{
+		Image:      imageFk,
+		From:       filter.From,
+		To:         filter.To,
+		Categories: filter.Categories,
+		Hourly:     []*HourlyStats{},
+	}
+
+	err := model.pool.QueryRow(ctx, selectImageWindow, imageFk, tenant).Scan(&stats.ActiveFrom, &stats.ExpiresAt, &stats.Expired)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+
+		return nil, err
+	}
+
+	query, args := selectImageHourlyStats, []any{imageFk, filter.From, filter.To, tenant}
+	if len(filter.Categories) > 0 {
+		query, args = selectImageHourlyStatsByCategory, append(args, filter.Categories)
+	}
+
+	rows, err := model.pool.Query(ctx, query, args...)
+	if err != nil {
+
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		hourly := &HourlyStats{}
+		if err := rows.Scan(&hourly.Bucket, &hourly.Fetches, &hourly.Fetchers, &hourly.OutOfWindowFetches, &hourly.DeduplicatedFetches, &hourly.HeadFetches); err != nil {
+			return nil, err
+		}
+
+		stats.Fetches += hourly.Fetches
+		stats.OutOfWindowFetches += hourly.OutOfWindowFetches
+		stats.DeduplicatedFetches += hourly.DeduplicatedFetches
+		stats.HeadFetches += hourly.HeadFetches
+		stats.Hourly = append(stats.Hourly, hourly)
+	}
+
+	// Released before the next query, the pool may hold a single connection.
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if filter.ByClient {
+		clients, err := model.clientStats(ctx, selectImageClientStats, imageFk, filter, tenant)
+		if err != nil {
+
+			return nil, err
+		}
+
+		stats.Clients = clients
+	}
+
+	select {
+	case <-ctx.Done():
+		model.logger.Errorf("Reading stats for %s went in error: %s", imageFk, ctx.Err().Error())
+		return nil, ctx.Err()
+	default:
+		return stats, nil
+	}
+}
+
+// clientStats runs a client break down query taking the image or campaign,
+// the window, the tenant and the categories.
+func (model *Model) clientStats(ctx context.Context, query string, id uuid.UUID, filter *StatsFilter, tenant uuid.UUID) ([]*ClientStats, error) {
+	var categories []string
+	if len(filter.Categories) > 0 {
+		categories = filter.Categories
+	}
+
+	rows, err := model.pool.Query(ctx, query, id, filter.From, filter.To, tenant, categories)
+	if err != nil {
+
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	clients := []*ClientStats{}
+	for rows.Next() {
+		client := &ClientStats{}
+		if err := rows.Scan(&client.MailClient, &client.Browser, &client.Os, &client.Device, &client.Fetches, &client.DeduplicatedFetches, &client.Fetchers); err != nil {
+			return nil, err
+		}
+
+		clients = append(clients, client)
+	}
+
+	return clients, rows.Err()
+}
+
+func (model *Model) RefreshRollups() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	tag, err := model.pool.Exec(ctx, refreshRollups)
+	if err != nil {
+
+		return err
+	}
+
+	select {
+	case <-ctx.Done():
+		model.logger.Errorf("Rollups refresh went in error: %s", ctx.Err().Error())
+		return ctx.Err()
+	default:
+		model.logger.Debugf("Rollups refresh done, %d hourly rows updated", tag.RowsAffected())
+		return nil
+	}
+}
+
+// BackfillRollups rebuilds the hourly rollups from the raw events, one day at
+// a time, starting from since or from the oldest recorded fetch when nil.
+func (model *Model) BackfillRollups(since *time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	if since == nil {
+		var oldest *time.Time
+		if err := model.pool.QueryRow(ctx, oldestImageAccess).Scan(&oldest); err != nil {
+			return err
+		}
+
+		if oldest == nil {
+			model.logger.Info("No fetches recorded, nothing to backfill")
+			return nil
+		}
+
+		since = oldest
+	}
+
+	until := time.Now().UTC().Truncate(time.Hour).Add(time.Hour)
+	for start := since.UTC().Truncate(time.Hour); start.Before(until); start = start.Add(24 * time.Hour) {
+		end := start.Add(24 * time.Hour)
+		if end.After(until) {
+			end = until
+		}
+
+		if err := model.rebuildRollups(start, end); err != nil {
+			return err
+		}
+
+		model.logger.Infof("Rollups rebuilt between %s and %s", start.Format(time.RFC3339), end.Format(time.RFC3339))
+	}
+
+	return nil
+}
+
+func (model *Model) rebuildRollups(from, to time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	tx, err := model.pool.BeginTx(ctx, *model.txOpts)
+	if err != nil {
+
+		return err
+	}
+
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, resetRollupsBetween, from, to); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, rebuildRollupsBetween, from, to); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (model *Model) rollupsMaintenance() {
+	defer model.background.Done()
+
+	for {
+		select {
+		case <-model.rollupsDone:
+			return
+		case _ = <-model.rollupsTicker.C:
+			err := model.RefreshRollups()
+
+			if err != nil {
+
+				model.logger.Errorf("Rollups refresh failed: %s", err.Error())
+			}
+		}
+	}
+}
+
+func (model *Model) initRollups() {
+	model.rollupsTicker = time.NewTicker(*model.postgresqlConfigurations.RollupsInterval)
+	model.rollupsDone = make(chan bool)
+	model.background.Add(1)
+	go model.rollupsMaintenance()
+}
@@ -0,0 +1,200 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// DefaultTenant owns everything recorded before tenants were introduced, and
+// everything managed while api keys are not required.
+var DefaultTenant = uuid.Nil
+
+var (
+	ErrTenantNotFound      = errors.New("tenant not found")
+	ErrTenantExists        = errors.New("tenant already exists")
+	ErrTenantQuotaExceeded = errors.New("tenant quota exceeded")
+)
+
+var (
+	insertTenant = strings.Join([]string{
+		"INSERT INTO mafiyrm.tenants(",
+		"  name,",
+		"  max_images,",
+		"  max_campaigns",
+		")",
+		"VALUES ($1, $2, $3)",
+		"RETURNING id, create_date",
+	}, " ")
+	selectTenants = strings.Join([]string{
+		"SELECT",
+		"  id,",
+		"  name,",
+		"  max_images,",
+		"  max_campaigns,",
+		"  (SELECT COUNT(*) FROM mafiyrm.images WHERE tenant_fk = tenants.id AND delete_date IS NULL),",
+		"  (SELECT COUNT(*) FROM mafiyrm.campaigns WHERE tenant_fk = tenants.id),",
+		"  create_date",
+		"FROM mafiyrm.tenants",
+		"ORDER BY create_date",
+	}, " ")
+	updateTenantQuotas = strings.Join([]string{
+		"UPDATE mafiyrm.tenants",
+		"SET",
+		"  max_images = $2,",
+		"  max_campaigns = $3",
+		"WHERE id = $1",
+	}, " ")
+	lockTenantQuotas = strings.Join([]string{
+		"SELECT",
+		"  max_images,",
+		"  max_campaigns",
+		"FROM mafiyrm.tenants",
+		"WHERE id = $1",
+		"FOR UPDATE",
+	}, " ")
+	countTenantImages = strings.Join([]string{
+		"SELECT COUNT(*)",
+		"FROM mafiyrm.images",
+		"WHERE tenant_fk = $1 AND delete_date IS NULL",
+	}, " ")
+	countTenantCampaigns = strings.Join([]string{
+		"SELECT COUNT(*)",
+		"FROM mafiyrm.campaigns",
+		"WHERE tenant_fk = $1",
+	}, " ")
+)
+
+// Tenant owns images, campaigns, webhooks and api keys. Nil quotas are not
+// enforced.
+type Tenant struct {
+	Id           uuid.UUID `json:"id"`
+	Name         string    `json:"name"`
+	MaxImages    *int      `json:"maxImages,omitempty"`
+	MaxCampaigns *int      `json:"maxCampaigns,omitempty"`
+	Images       int64     `json:"images"`
+	Campaigns    int64     `json:"campaigns"`
+	CreateDate   time.Time `json:"createDate"`
+}
+
+func (model *Model) CreateTenant(name string, maxImages, maxCampaigns *int) (*Tenant, error) {
+	model.logger.Debugf("Creating tenant %s", name)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	tenant := &Tenant{
+		Name:         name,
+		MaxImages:    maxImages,
+		MaxCampaigns: maxCampaigns,
+	}
+
+	err := model.pool.QueryRow(ctx, insertTenant, name, maxImages, maxCampaigns).
+		Scan(&tenant.Id, &tenant.CreateDate)
+	if isUniqueViolation(err) {
+
+		return nil, ErrTenantExists
+	} else if err != nil {
+
+		return nil, err
+	}
+
+	model.logger.Infof("Tenant %s created as %s", name, tenant.Id)
+	return tenant, nil
+}
+
+func (model *Model) Tenants() ([]*Tenant, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	rows, err := model.pool.Query(ctx, selectTenants)
+	if err != nil {
+
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	tenants := []*Tenant{}
+	for rows.Next() {
+		tenant := &Tenant{}
+		err := rows.Scan(&tenant.Id, &tenant.Name, &tenant.MaxImages, &tenant.MaxCampaigns,
+			&tenant.Images, &tenant.Campaigns, &tenant.CreateDate)
+		if err != nil {
+			return nil, err
+		}
+
+		tenants = append(tenants, tenant)
+	}
+
+	return tenants, rows.Err()
+}
+
+func (model *Model) SetTenantQuotas(id uuid.UUID, maxImages, maxCampaigns *int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	tag, err := model.pool.Exec(ctx, updateTenantQuotas, id, maxImages, maxCampaigns)
+	if err != nil {
+
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+
+		return ErrTenantNotFound
+	}
+
+	model.logger.Infof("Tenant %s quotas updated", id)
+	return nil
+}
+
+// reserveTenantQuota fails with ErrTenantQuotaExceeded when the tenant already
+// reached its quota of images or campaigns, as picked by pick. It has to run
+// within the transaction creating the new row: the tenant stays locked until
+// then, so that concurrent creations can not overrun the quota. The rows are
+// counted once the lock is held, for the count to see every committed row.
+func reserveTenantQuota(ctx context.Context, tx pgx.Tx, tenant uuid.UUID, countQuery string, pick func(maxImages, maxCampaigns *int) *int) error {
+	var maxImages, maxCampaigns *int
+	err := tx.QueryRow(ctx, lockTenantQuotas, tenant).Scan(&maxImages, &maxCampaigns)
+	if errors.Is(err, pgx.ErrNoRows) {
+
+		return ErrTenantNotFound
+	} else if err != nil {
+
+		return err
+	}
+
+	quota := pick(maxImages, maxCampaigns)
+	if quota == nil {
+
+		return nil
+	}
+
+	var used int64
+	if err := tx.QueryRow(ctx, countQuery, tenant).Scan(&used); err != nil {
+		return err
+	}
+
+	if used >= int64(*quota) {
+
+		return ErrTenantQuotaExceeded
+	}
+
+	return nil
+}
+
+func reserveTenantImage(ctx context.Context, tx pgx.Tx, tenant uuid.UUID) error {
+	return reserveTenantQuota(ctx, tx, tenant, countTenantImages, func(maxImages, _ *int) *int {
+		return maxImages
+	})
+}
+
+func reserveTenantCampaign(ctx context.Context, tx pgx.Tx, tenant uuid.UUID) error {
+	return reserveTenantQuota(ctx, tx, tenant, countTenantCampaigns, func(_, maxCampaigns *int) *int {
+		return maxCampaigns
+	})
+}
@@ -0,0 +1,266 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliveryDelivered = "delivered"
+	WebhookDeliveryDead      = "dead"
+)
+
+var ErrWebhookNotFound = errors.New("webhook not found")
+
+var (
+	insertWebhook = strings.Join([]string{
+		"INSERT INTO mafiyrm.webhooks(",
+		"  tenant_fk,",
+		"  image_fk,",
+		"  url,",
+		"  secret,",
+		"  first_fetch_only",
+		")",
+		"SELECT $5, $1, $2, $3, $4",
+		"WHERE $1::uuid IS NULL",
+		"  OR EXISTS (SELECT 1 FROM mafiyrm.images WHERE id = $1 AND tenant_fk = $5)",
+		"RETURNING id, create_date",
+	}, " ")
+	selectWebhooks = strings.Join([]string{
+		"SELECT",
+		"  id,",
+		"  image_fk,",
+		"  url,",
+		"  first_fetch_only,",
+		"  create_date",
+		"FROM mafiyrm.webhooks",
+		"WHERE tenant_fk = $1 AND NOT disabled",
+		"ORDER BY create_date",
+	}, " ")
+	disableWebhook = strings.Join([]string{
+		"UPDATE mafiyrm.webhooks",
+		"SET",
+		"  disabled = TRUE",
+		"WHERE id = $1 AND tenant_fk = $2 AND NOT disabled",
+	}, " ")
+	// Claiming the first fetch on the image row serializes concurrent first
+	// fetches: the later ones wait for the row lock and then find it taken.
+	enqueueWebhookDeliveries = strings.Join([]string{
+		"WITH claimed AS (",
+		"  UPDATE mafiyrm.images",
+		"  SET first_fetch_date = CURRENT_TIMESTAMP",
+		"  WHERE id = $1::uuid AND first_fetch_date IS NULL",
+		"  RETURNING id",
+		"), this_fetch AS (",
+		"  SELECT EXISTS (SELECT 1 FROM claimed) AS first_fetch",
+		")",
+		"INSERT INTO mafiyrm.webhook_deliveries(",
+		"  webhook_fk,",
+		"  payload",
+		")",
+		"SELECT",
+		"  webhooks.id,",
+		"  json_build_object(",
+		"    'webhook', webhooks.id,",
+		"    'image', $1::uuid,",
+		"    'usedIn', (SELECT used_in FROM mafiyrm.images WHERE id = $1::uuid),",
+		"    'remoteAddr', $2::varchar,",
+		"    'recipient', NULLIF($3::varchar, ''),",
+		"    'category', NULLIF($4::varchar, ''),",
+		"    'firstFetch', this_fetch.first_fetch,",
+		"    'date', CURRENT_TIMESTAMP",
+		"  )",
+		"FROM mafiyrm.webhooks, this_fetch",
+		"WHERE NOT webhooks.disabled",
+		"  AND webhooks.tenant_fk = (SELECT tenant_fk FROM mafiyrm.images WHERE id = $1::uuid)",
+		"  AND (webhooks.image_fk IS NULL OR webhooks.image_fk = $1::uuid)",
+		"  AND (NOT webhooks.first_fetch_only OR this_fetch.first_fetch)",
+	}, " ")
+	claimWebhookDeliveries = strings.Join([]string{
+		"UPDATE mafiyrm.webhook_deliveries AS deliveries",
+		"SET",
+		"  attempts = deliveries.attempts + 1,",
+		"  next_attempt_date = CURRENT_TIMESTAMP + make_interval(secs => $2)",
+		"FROM mafiyrm.webhooks",
+		"WHERE webhooks.id = deliveries.webhook_fk",
+		"  AND deliveries.id IN (",
+		"    SELECT id",
+		"    FROM mafiyrm.webhook_deliveries",
+		"    WHERE status = '" + WebhookDeliveryPending + "'",
+		"      AND next_attempt_date <= CURRENT_TIMESTAMP",
+		"    ORDER BY next_attempt_date",
+		"    LIMIT $1",
+		"    FOR UPDATE SKIP LOCKED",
+		"  )",
+		"RETURNING",
+		"  deliveries.id,",
+		"  deliveries.attempts,",
+		"  deliveries.payload::text,",
+		"  webhooks.url,",
+		"  webhooks.secret",
+	}, " ")
+	markWebhookDelivered = strings.Join([]string{
+		"UPDATE mafiyrm.webhook_deliveries",
+		"SET",
+		"  status = '" + WebhookDeliveryDelivered + "',",
+		"  last_error = NULL",
+		"WHERE id = $1",
+	}, " ")
+	markWebhookRetry = strings.Join([]string{
+		"UPDATE mafiyrm.webhook_deliveries",
+		"SET",
+		"  next_attempt_date = CURRENT_TIMESTAMP + make_interval(secs => $3),",
+		"  last_error = $2",
+		"WHERE id = $1",
+	}, " ")
+	markWebhookDead = strings.Join([]string{
+		"UPDATE mafiyrm.webhook_deliveries",
+		"SET",
+		"  status = '" + WebhookDeliveryDead + "',",
+		"  last_error = $2",
+		"WHERE id = $1",
+	}, " ")
+)
+
+type Webhook struct {
+	Id             uuid.UUID  `json:"id"`
+	Image          *uuid.UUID `json:"image,omitempty"`
+	Url            string     `json:"url"`
+	Secret         string     `json:"secret,omitempty"`
+	FirstFetchOnly bool       `json:"firstFetchOnly"`
+	CreateDate     time.Time  `json:"createDate"`
+}
+
+type WebhookDelivery struct {
+	Id       uuid.UUID
+	Attempts int
+	Payload  string
+	Url      string
+	Secret   string
+}
+
+// CreateWebhook registers a webhook of tenant, either on one of its images or
+// on all of them when webhook.Image is nil.
+func (model *Model) CreateWebhook(tenant uuid.UUID, webhook *Webhook) error {
+	model.logger.Debugf("Creating webhook towards %s", webhook.Url)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	err := model.pool.QueryRow(ctx, insertWebhook, webhook.Image, webhook.Url, webhook.Secret, webhook.FirstFetchOnly, tenant).
+		Scan(&webhook.Id, &webhook.CreateDate)
+	if errors.Is(err, pgx.ErrNoRows) {
+
+		return ErrImageNotFound
+	} else if err != nil {
+
+		return err
+	}
+
+	model.logger.Infof("Webhook %s towards %s created", webhook.Id, webhook.Url)
+	return nil
+}
+
+func (model *Model) Webhooks(tenant uuid.UUID) ([]*Webhook, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	rows, err := model.pool.Query(ctx, selectWebhooks, tenant)
+	if err != nil {
+
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	webhooks := []*Webhook{}
+	for rows.Next() {
+		webhook := &Webhook{}
+		if err := rows.Scan(&webhook.Id, &webhook.Image, &webhook.Url, &webhook.FirstFetchOnly, &webhook.CreateDate); err != nil {
+			return nil, err
+		}
+
+		webhooks = append(webhooks, webhook)
+	}
+
+	return webhooks, rows.Err()
+}
+
+func (model *Model) DisableWebhook(tenant, id uuid.UUID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	tag, err := model.pool.Exec(ctx, disableWebhook, id, tenant)
+	if err != nil {
+
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+
+		return ErrWebhookNotFound
+	}
+
+	model.logger.Infof("Webhook %s disabled", id)
+	return nil
+}
+
+func enqueueWebhooks(ctx context.Context, tx pgx.Tx, fetch *ImageFetch) error {
+	_, err := tx.Exec(ctx, enqueueWebhookDeliveries, fetch.Image, fetch.RemoteAddr, fetch.Recipient, fetch.Category)
+	return err
+}
+
+// ClaimWebhookDeliveries leases up to limit due deliveries, so that other
+// replicas skip them until the lease expires or the outcome is recorded.
+func (model *Model) ClaimWebhookDeliveries(limit int, lease time.Duration) ([]*WebhookDelivery, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	rows, err := model.pool.Query(ctx, claimWebhookDeliveries, limit, lease.Seconds())
+	if err != nil {
+
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	deliveries := []*WebhookDelivery{}
+	for rows.Next() {
+		delivery := &WebhookDelivery{}
+		if err := rows.Scan(&delivery.Id, &delivery.Attempts, &delivery.Payload, &delivery.Url, &delivery.Secret); err != nil {
+			return nil, err
+		}
+
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, rows.Err()
+}
+
+func (model *Model) WebhookDelivered(id uuid.UUID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	_, err := model.pool.Exec(ctx, markWebhookDelivered, id)
+	return err
+}
+
+// WebhookFailed records a failed attempt, scheduling the next one after
+// retryIn or moving the delivery to the dead-letter state when retryIn is nil.
+func (model *Model) WebhookFailed(id uuid.UUID, reason string, retryIn *time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	if retryIn == nil {
+		_, err := model.pool.Exec(ctx, markWebhookDead, id, reason)
+		return err
+	}
+
+	_, err := model.pool.Exec(ctx, markWebhookRetry, id, reason, retryIn.Seconds())
+	return err
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"errors"
+	logging "fetch-me-if-you-read-me/logger"
+	"fetch-me-if-you-read-me/model"
+	"fmt"
+
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+const (
+	scopeRead   = model.ApiKeyScopeRead
+	scopeCreate = model.ApiKeyScopeCreate
+	scopeAdmin  = model.ApiKeyScopeAdmin
+)
+
+type apiKeyContextKey struct{}
+
+// authentication is the router middleware guarding management routes: routes
+// protected with a scope require a bearer api key granted that scope, every
+// other route, the pixel among them, stays public.
+type authentication struct {
+	logger   *zap.SugaredLogger
+	model    *model.Model
+	required bool
+	scopes   map[*mux.Route]string
+}
+
+func (a *authentication) protect(route *mux.Route, scope string) *mux.Route {
+	a.scopes[route] = scope
+	return route
+}
+
+func (a *authentication) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scope, protected := a.scopes[mux.CurrentRoute(r)]
+		if !a.required || !protected {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key, found := bearerToken(r)
+		if !found {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="mafiyrm"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		apiKey, err := a.model.AuthenticateApiKey(key)
+		if errors.Is(err, model.ErrApiKeyNotFound) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="mafiyrm", error="invalid_token"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		} else if err != nil {
+			a.logger.Error(err.Error())
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		if !apiKey.Allows(scope) {
+			a.logger.Debugf("Api key %s is not granted %s on %s %s", apiKey.Id, scope, r.Method, r.URL.Path)
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="mafiyrm", error="insufficient_scope", scope="%s"`, scope))
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiKeyContextKey{}, apiKey)))
+	})
+}
+
+// apiKeyOf returns the api key authenticating r, if any.
+func apiKeyOf(r *http.Request) *model.ApiKey {
+	apiKey, _ := r.Context().Value(apiKeyContextKey{}).(*model.ApiKey)
+	return apiKey
+}
+
+// tenantOf returns the tenant of the api key authenticating r, requests are
+// all on behalf of the default tenant while api keys are not required.
+func tenantOf(r *http.Request) uuid.UUID {
+	apiKey := apiKeyOf(r)
+	if apiKey == nil {
+
+		return model.DefaultTenant
+	}
+
+	return apiKey.Tenant
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+
+		return "", false
+	}
+
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+func newAuthentication(logger *logging.Logger, model *model.Model, required bool) *authentication {
+	return &authentication{
+		logger:   logger.Log,
+		model:    model,
+		required: required,
+		scopes:   map[*mux.Route]string{},
+	}
+}
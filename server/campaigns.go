@@ -0,0 +1,156 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	logging "fetch-me-if-you-read-me/logger"
+	"fetch-me-if-you-read-me/model"
+
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+type CampaignCreation struct {
+	Name        string
+	Description string
+	StartDate   *time.Time
+	EndDate     *time.Time
+}
+
+type campaigns struct {
+	logger       *zap.SugaredLogger
+	model        *model.Model
+	maxBodyBytes int64
+}
+
+func (c *campaigns) createCampaign(w http.ResponseWriter, r *http.Request) {
+	var aCampaignCreation CampaignCreation
+	err := decodeJSONBody(w, r, &aCampaignCreation, c.maxBodyBytes)
+	if err != nil {
+		var mr *malformedRequest
+		if errors.As(err, &mr) {
+			http.Error(w, mr.msg, mr.status)
+		} else {
+			c.logger.Error(err.Error())
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if strings.TrimSpace(aCampaignCreation.Name) == "" {
+		http.Error(w, "Name must not be empty", http.StatusBadRequest)
+		return
+	}
+
+	if aCampaignCreation.StartDate != nil && aCampaignCreation.EndDate != nil &&
+		aCampaignCreation.EndDate.Before(*aCampaignCreation.StartDate) {
+		http.Error(w, "EndDate must not precede StartDate", http.StatusBadRequest)
+		return
+	}
+
+	campaign := &model.Campaign{
+		Name:        aCampaignCreation.Name,
+		Description: aCampaignCreation.Description,
+		StartDate:   aCampaignCreation.StartDate,
+		EndDate:     aCampaignCreation.EndDate,
+	}
+	err = c.model.CreateCampaign(tenantOf(r), campaign)
+	if errors.Is(err, model.ErrCampaignExists) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	} else if errors.Is(err, model.ErrTenantQuotaExceeded) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	} else if err != nil {
+		c.logger.Error(err.Error())
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(campaign)
+}
+
+func (c *campaigns) listCampaigns(w http.ResponseWriter, r *http.Request) {
+	campaigns, err := c.model.Campaigns(tenantOf(r))
+	if err != nil {
+		c.logger.Error(err.Error())
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(campaigns)
+}
+
+func (c *campaigns) getCampaign(w http.ResponseWriter, r *http.Request) {
+	campaign, ok := c.lookupCampaign(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(campaign)
+}
+
+func (c *campaigns) campaignStats(w http.ResponseWriter, r *http.Request) {
+	campaign, ok := c.lookupCampaign(w, r)
+	if !ok {
+		return
+	}
+
+	filter, err := parseStatsFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	stats, err := c.model.CampaignStats(tenantOf(r), campaign.Id, filter)
+	if err != nil {
+		c.logger.Error(err.Error())
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(stats)
+}
+
+func (c *campaigns) lookupCampaign(w http.ResponseWriter, r *http.Request) (*model.Campaign, bool) {
+	vars := mux.Vars(r)
+
+	campaignUUID, err := uuid.Parse(vars["uuid"])
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return nil, false
+	}
+
+	campaign, err := c.model.Campaign(tenantOf(r), campaignUUID)
+	if errors.Is(err, model.ErrCampaignNotFound) {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return nil, false
+	} else if err != nil {
+		c.logger.Error(err.Error())
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return nil, false
+	}
+
+	return campaign, true
+}
+
+func newCampaigns(logger *logging.Logger, model *model.Model, maxBodyBytes int64) *campaigns {
+	return &campaigns{
+		logger:       logger.Log,
+		model:        model,
+		maxBodyBytes: maxBodyBytes,
+	}
+}
@@ -0,0 +1,181 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+const (
+	ClientIPHeaderXForwardedFor = "X-Forwarded-For"
+	ClientIPHeaderForwarded     = "Forwarded"
+	ClientIPHeaderXRealIp       = "X-Real-Ip"
+)
+
+// clientIPs resolves the ip of the client sending a request. The forwarding
+// header is only believed when the connection comes from a trusted proxy,
+// and its hops are walked right to left as long as they are trusted proxies
+// too: the first untrusted hop is the client. Only the header the proxies
+// set is read, the other ones come from the client as they are.
+type clientIPs struct {
+	trusted []*net.IPNet
+	header  string
+}
+
+// newClientIPs parses the comma separated trusted proxy cidrs, whose header
+// is one of the ClientIPHeader constants.
+func newClientIPs(trustedProxies, header string) (*clientIPs, error) {
+	trusted, err := parseNetworks(trustedProxies)
+	if err != nil {
+
+		return nil, fmt.Errorf("trusted proxies: %w", err)
+	}
+
+	header = http.CanonicalHeaderKey(header)
+	if header != ClientIPHeaderXForwardedFor && header != ClientIPHeaderForwarded && header != ClientIPHeaderXRealIp {
+
+		return nil, fmt.Errorf("client ip header must be %s, %s or %s", ClientIPHeaderXForwardedFor, ClientIPHeaderForwarded, ClientIPHeaderXRealIp)
+	}
+
+	return &clientIPs{
+		trusted: trusted,
+		header:  header,
+	}, nil
+}
+
+// parseNetworks parses comma separated cidrs, single ips are accepted as
+// well.
+func parseNetworks(values string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, value := range strings.Split(values, ",") {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+
+				return nil, fmt.Errorf("%s is neither a cidr nor an ip", value)
+			}
+
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+
+			return nil, fmt.Errorf("%s is neither a cidr nor an ip", value)
+		}
+
+		networks = append(networks, network)
+	}
+
+	return networks, nil
+}
+
+func containsIP(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c *clientIPs) isTrusted(ip net.IP) bool {
+	return containsIP(c.trusted, ip)
+}
+
+// resolve returns the client ip of r, or nil when its remote address is not
+// an ip.
+func (c *clientIPs) resolve(r *http.Request) net.IP {
+	remote := parseHostIP(r.RemoteAddr)
+	if remote == nil || !c.isTrusted(remote) {
+
+		return remote
+	}
+
+	var hops []string
+	switch c.header {
+	case ClientIPHeaderForwarded:
+		hops = forwardedFor(r.Header.Values(c.header))
+	case ClientIPHeaderXForwardedFor:
+		for _, value := range r.Header.Values(c.header) {
+			hops = append(hops, strings.Split(value, ",")...)
+		}
+	case ClientIPHeaderXRealIp:
+		if value := r.Header.Get(c.header); value != "" {
+			hops = []string{value}
+		}
+	}
+
+	client := remote
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := parseHostIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+
+			// Unknown or obfuscated hops cannot be walked past, the last
+			// trusted proxy is the best known client.
+			return client
+		}
+
+		client = hop
+		if !c.isTrusted(hop) {
+
+			return client
+		}
+	}
+
+	return client
+}
+
+// key is the rate limit key of the client sending r.
+func (c *clientIPs) key(r *http.Request) string {
+	if ip := c.resolve(r); ip != nil {
+
+		return "ip:" + ip.String()
+	}
+
+	return "ip:" + r.RemoteAddr
+}
+
+// forwardedFor reads the for parameters of RFC 7239 Forwarded header values,
+// in hops order.
+func forwardedFor(values []string) []string {
+	var hops []string
+	for _, value := range values {
+		for _, element := range strings.Split(value, ",") {
+			for _, pair := range strings.Split(element, ";") {
+				name, parameter, found := strings.Cut(strings.TrimSpace(pair), "=")
+				if !found || !strings.EqualFold(name, "for") {
+					continue
+				}
+
+				hops = append(hops, strings.Trim(parameter, `"`))
+			}
+		}
+	}
+
+	return hops
+}
+
+// parseHostIP parses an ip, optionally with a port, with IPv6 ones possibly
+// in brackets.
+func parseHostIP(address string) net.IP {
+	if host, _, err := net.SplitHostPort(address); err == nil {
+		address = host
+	}
+
+	return net.ParseIP(strings.TrimSuffix(strings.TrimPrefix(address, "["), "]"))
+}
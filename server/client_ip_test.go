@@ -0,0 +1,47 @@
+package server
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveClientIP(t *testing.T) {
+	for _, test := range []struct {
+		header     string
+		remoteAddr string
+		headers    map[string]string
+		expected   string
+		message    string
+	}{
+		{ClientIPHeaderXForwardedFor, "203.0.113.1:4321", map[string]string{"X-Forwarded-For": "198.51.100.1"}, "203.0.113.1", "Untrusted peers headers have to be ignored"},
+		{ClientIPHeaderXForwardedFor, "10.0.0.1:4321", nil, "10.0.0.1", "Trusted peers without headers are the client"},
+		{ClientIPHeaderXForwardedFor, "10.0.0.1:4321", map[string]string{"X-Forwarded-For": "198.51.100.1, 203.0.113.7, 10.0.0.2"}, "203.0.113.7", "Forwarded for has to be walked right to left"},
+		{ClientIPHeaderXForwardedFor, "192.168.1.1:4321", map[string]string{"X-Forwarded-For": "10.0.0.3, 10.0.0.2"}, "10.0.0.3", "Fully trusted chains end at their first hop"},
+		{ClientIPHeaderXForwardedFor, "10.0.0.1:4321", map[string]string{"X-Forwarded-For": "198.51.100.1, garbage, 10.0.0.2"}, "10.0.0.2", "Unparseable hops must not be walked past"},
+		{ClientIPHeaderForwarded, "10.0.0.1:4321", map[string]string{"Forwarded": `for=198.51.100.1;proto=https, for="[2001:db8::1]:4711"`}, "2001:db8::1", "Forwarded header has to be read"},
+		{ClientIPHeaderForwarded, "10.0.0.1:4321", map[string]string{"Forwarded": "for=unknown"}, "10.0.0.1", "Unknown Forwarded hops must not be walked past"},
+		{ClientIPHeaderXRealIp, "10.0.0.1:4321", map[string]string{"X-Real-Ip": "198.51.100.1"}, "198.51.100.1", "X-Real-Ip of trusted peers has to be read"},
+		{ClientIPHeaderXForwardedFor, "10.0.0.1:4321", map[string]string{"Forwarded": "for=198.51.100.9", "X-Forwarded-For": "198.51.100.1"}, "198.51.100.1", "Headers other than the configured one have to be ignored"},
+		{ClientIPHeaderForwarded, "10.0.0.1:4321", map[string]string{"X-Forwarded-For": "198.51.100.1"}, "10.0.0.1", "Headers other than the configured one have to be ignored"},
+		{ClientIPHeaderXForwardedFor, "[2001:db8::2]:4321", nil, "2001:db8::2", "IPv6 remote addresses have to be stripped of their port"},
+	} {
+		resolver, err := newClientIPs("10.0.0.0/8, 192.168.1.1", test.header)
+		assert.Nil(t, err, "Error has to be nil")
+
+		r := httptest.NewRequest("GET", "/images/x", nil)
+		r.RemoteAddr = test.remoteAddr
+		for name, value := range test.headers {
+			r.Header.Set(name, value)
+		}
+
+		assert.Equal(t, test.expected, resolver.resolve(r).String(), test.message)
+	}
+
+	_, err := newClientIPs("10.0.0.0/33", ClientIPHeaderXForwardedFor)
+	assert.NotNil(t, err, "Error has to be not nil for malformed cidrs")
+
+	_, err = newClientIPs("10.0.0.0/8", "X-Client-Ip")
+	assert.NotNil(t, err, "Error has to be not nil for unsupported headers")
+}
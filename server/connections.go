@@ -0,0 +1,46 @@
+package server
+
+import (
+	"net"
+	"sync"
+)
+
+// limitListener accepts at most max connections at once, further ones wait
+// in the backlog until an accepted connection is closed.
+type limitListener struct {
+	net.Listener
+	slots chan struct{}
+}
+
+func newLimitListener(listener net.Listener, max int) *limitListener {
+	return &limitListener{
+		Listener: listener,
+		slots:    make(chan struct{}, max),
+	}
+}
+
+func (l *limitListener) Accept() (net.Conn, error) {
+	l.slots <- struct{}{}
+
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		<-l.slots
+		return nil, err
+	}
+
+	return &limitConn{Conn: conn, release: func() { <-l.slots }}, nil
+}
+
+// limitConn gives its slot back once, however many times it is closed.
+type limitConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+func (c *limitConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(c.release)
+
+	return err
+}
@@ -0,0 +1,50 @@
+package server
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimitListener(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err, "Error has to be nil")
+	limited := newLimitListener(listener, 1)
+	defer limited.Close()
+
+	for i := 0; i < 2; i++ {
+		client, err := net.Dial("tcp", listener.Addr().String())
+		assert.Nil(t, err, "Error has to be nil")
+		defer client.Close()
+	}
+
+	first, err := limited.Accept()
+	assert.Nil(t, err, "Error has to be nil")
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := limited.Accept()
+		if err == nil {
+			accepted <- conn
+		}
+	}()
+
+	select {
+	case <-accepted:
+		t.Fatal("Second connection must wait for the first one to close")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	first.Close()
+	first.Close()
+	select {
+	case second := <-accepted:
+		second.Close()
+	case <-time.After(time.Second):
+		t.Fatal("Second connection has to be accepted once the first one closes")
+	}
+
+	assert.Equal(t, 0, len(limited.slots), "Slots have to be released once per connection")
+}
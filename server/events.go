@@ -0,0 +1,100 @@
+package server
+
+import (
+	"encoding/json"
+	logging "fetch-me-if-you-read-me/logger"
+	"fetch-me-if-you-read-me/model"
+
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const eventsHeartbeat = 15 * time.Second
+
+type events struct {
+	logger    *zap.SugaredLogger
+	subscribe func() (<-chan *model.FetchEvent, func())
+	closing   <-chan struct{}
+}
+
+func (e *events) eventsHandler(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		e.logger.Error("Response writer does not support flushing")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	var imageFilter *uuid.UUID
+	if value := r.URL.Query().Get("image"); value != "" {
+		imageFkUUID, err := uuid.Parse(value)
+		if err != nil {
+			http.Error(w, "Query parameter image is not a valid uuid", http.StatusBadRequest)
+			return
+		}
+
+		imageFilter = &imageFkUUID
+	}
+	usedInFilter := r.URL.Query().Get("usedIn")
+	tenant := tenantOf(r)
+
+	fetchEvents, unsubscribe := e.subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(eventsHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			e.logger.Debug("Events subscriber gone")
+			return
+		case <-e.closing:
+			e.logger.Debug("Closing events stream for shutdown")
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+			flusher.Flush()
+		case event := <-fetchEvents:
+			if event.Tenant == nil || *event.Tenant != tenant {
+				continue
+			}
+
+			if imageFilter != nil && *imageFilter != event.Image {
+				continue
+			}
+
+			if usedInFilter != "" && usedInFilter != event.UsedIn {
+				continue
+			}
+
+			data, err := json.Marshal(event)
+			if err != nil {
+				e.logger.Error(err.Error())
+				continue
+			}
+
+			fmt.Fprintf(w, "event: fetch\ndata: %s\n\n", data)
+			flusher.Flush()
+		}
+	}
+}
+
+func newEvents(logger *logging.Logger, model *model.Model, closing <-chan struct{}) *events {
+	return &events{
+		logger:    logger.Log,
+		subscribe: model.SubscribeFetchEvents,
+		closing:   closing,
+	}
+}
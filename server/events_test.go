@@ -0,0 +1,47 @@
+package server
+
+import (
+	"bufio"
+	"fetch-me-if-you-read-me/model"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestEventsStreamOutlivesTimeouts(t *testing.T) {
+	fetchEvents := make(chan *model.FetchEvent, 1)
+	e := &events{
+		logger: zap.NewNop().Sugar(),
+		subscribe: func() (<-chan *model.FetchEvent, func()) {
+			return fetchEvents, func() {}
+		},
+		closing: make(chan struct{}),
+	}
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(e.eventsHandler))
+	ts.Config = newHTTPServer(&ServerConfs{
+		ReadHeaderTimeout: 100 * time.Millisecond,
+		IdleTimeout:       100 * time.Millisecond,
+	}, http.HandlerFunc(e.eventsHandler), nil)
+	ts.Start()
+	defer ts.Close()
+
+	response, err := http.Get(ts.URL)
+	assert.Nil(t, err, "Error has to be nil")
+	defer response.Body.Close()
+
+	time.Sleep(500 * time.Millisecond)
+	tenant := model.DefaultTenant
+	fetchEvents <- &model.FetchEvent{Image: uuid.New(), Tenant: &tenant}
+
+	reader := bufio.NewReader(response.Body)
+	line, err := reader.ReadString('\n')
+	assert.Nil(t, err, "Stream has to be still open past the timeouts")
+	assert.True(t, strings.HasPrefix(line, "event: fetch"), "Event has to be streamed, got %q", line)
+}
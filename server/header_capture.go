@@ -0,0 +1,141 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// HeaderCapturePresetSafe drops the headers carrying credentials and
+	// redacts credentials found in the other ones.
+	HeaderCapturePresetSafe = "safe"
+	// HeaderCapturePresetNone only applies the configured policy.
+	HeaderCapturePresetNone = "none"
+
+	redacted = "[redacted]"
+)
+
+var (
+	safeDeniedHeaders = []string{
+		"Authorization",
+		"Cookie",
+		"Proxy-Authorization",
+		"Set-Cookie",
+		"X-Api-Key",
+		"X-Auth-Token",
+		"X-Csrf-Token",
+		"X-Xsrf-Token",
+	}
+	safeRedaction = regexp.MustCompile(`(?i)\b(?:access_token|api_?key|auth|code|password|secret|session|sig|signature|token)=[^&\s;,]+`)
+)
+
+// headerCapture tells which request headers are stored with a fetch: the
+// allowed ones, or all of them when none is, except the denied ones. Values
+// have the redactions matches replaced and are truncated to maxLength bytes,
+// unless it is 0.
+type headerCapture struct {
+	allowed    map[string]struct{}
+	denied     map[string]struct{}
+	redactions []*regexp.Regexp
+	maxLength  int
+}
+
+// newHeaderCapture builds the policy of preset, extended with the comma
+// separated allow and deny header lists and the redact expression.
+func newHeaderCapture(preset, allow, deny, redact string, maxLength int) (*headerCapture, error) {
+	capture := &headerCapture{
+		allowed:   headerSet(allow),
+		denied:    headerSet(deny),
+		maxLength: maxLength,
+	}
+
+	switch preset {
+	case HeaderCapturePresetSafe:
+		for _, header := range safeDeniedHeaders {
+			capture.denied[header] = struct{}{}
+		}
+
+		capture.redactions = append(capture.redactions, safeRedaction)
+	case HeaderCapturePresetNone:
+	default:
+		return nil, fmt.Errorf("header capture preset must be %s or %s", HeaderCapturePresetSafe, HeaderCapturePresetNone)
+	}
+
+	if redact != "" {
+		expression, err := regexp.Compile(redact)
+		if err != nil {
+
+			return nil, fmt.Errorf("header capture redaction: %w", err)
+		}
+
+		capture.redactions = append(capture.redactions, expression)
+	}
+
+	if maxLength < 0 {
+
+		return nil, fmt.Errorf("header capture max length must not be negative")
+	}
+
+	return capture, nil
+}
+
+func headerSet(headers string) map[string]struct{} {
+	set := map[string]struct{}{}
+	for _, header := range strings.Split(headers, ",") {
+		if header = strings.TrimSpace(header); header != "" {
+			set[http.CanonicalHeaderKey(header)] = struct{}{}
+		}
+	}
+
+	return set
+}
+
+func (c *headerCapture) captures(header string) bool {
+	if _, found := c.denied[header]; found {
+
+		return false
+	}
+
+	if len(c.allowed) == 0 {
+
+		return true
+	}
+
+	_, found := c.allowed[header]
+	return found
+}
+
+func (c *headerCapture) value(value string) string {
+	for _, redaction := range c.redactions {
+		value = redaction.ReplaceAllString(value, redacted)
+	}
+
+	if c.maxLength > 0 && len(value) > c.maxLength {
+		cut := c.maxLength
+		for cut > 0 && !utf8.RuneStart(value[cut]) {
+			cut--
+		}
+
+		value = value[:cut]
+	}
+
+	return value
+}
+
+// capture returns the headers and trailers of r to store, trailers taking
+// over headers of the same name.
+func (c *headerCapture) capture(r *http.Request) map[string]string {
+	meta := make(map[string]string)
+	for _, headers := range []http.Header{r.Header, r.Trailer} {
+		for key := range headers {
+			if c.captures(key) {
+				meta[key] = c.value(headers.Get(key))
+			}
+		}
+	}
+
+	return meta
+}
@@ -0,0 +1,50 @@
+package server
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeaderCapture(t *testing.T) {
+	r := httptest.NewRequest("GET", "/images/x", nil)
+	r.Header.Set("User-Agent", "Mozilla/5.0")
+	r.Header.Set("Cookie", "session=secret")
+	r.Header.Set("Authorization", "Bearer secret")
+	r.Header.Set("Referer", "https://mail.example.com/read?id=1&token=secret")
+	r.Header.Set("Accept-Language", "it-IT,it;q=0.9,en;q=0.8")
+
+	capture, err := newHeaderCapture(HeaderCapturePresetSafe, "", "accept-language", "", 0)
+	assert.Nil(t, err, "Error has to be nil")
+	assert.Equal(t, map[string]string{
+		"User-Agent": "Mozilla/5.0",
+		"Referer":    "https://mail.example.com/read?id=1&[redacted]",
+	}, capture.capture(r), "Credentials and denied headers must not be captured")
+
+	capture, err = newHeaderCapture(HeaderCapturePresetNone, "user-agent,cookie", "", "Mozilla", 4)
+	assert.Nil(t, err, "Error has to be nil")
+	assert.Equal(t, map[string]string{
+		"User-Agent": "[red",
+		"Cookie":     "sess",
+	}, capture.capture(r), "Only allowed headers have to be captured, redacted and truncated")
+
+	for _, test := range []struct {
+		preset    string
+		redact    string
+		maxLength int
+	}{
+		{"everything", "", 0},
+		{HeaderCapturePresetSafe, "(", 0},
+		{HeaderCapturePresetSafe, "", -1},
+	} {
+		_, err = newHeaderCapture(test.preset, "", "", test.redact, test.maxLength)
+		assert.NotNil(t, err, "Error has to be not nil for %+v", test)
+	}
+}
+
+func TestHeaderCaptureTruncatesRunes(t *testing.T) {
+	capture, _ := newHeaderCapture(HeaderCapturePresetNone, "", "", "", 2)
+
+	assert.Equal(t, "a", capture.value("aèb"), "Truncation must not split runes")
+}
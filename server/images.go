@@ -0,0 +1,228 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	logging "fetch-me-if-you-read-me/logger"
+	"fetch-me-if-you-read-me/model"
+
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultImagesLimit = 50
+	maxImagesLimit     = 500
+)
+
+type ImagePatch struct {
+	UsedIn     optional[string]
+	Campaign   optional[uuid.UUID]
+	ActiveFrom optional[time.Time]
+	ExpiresAt  optional[time.Time]
+	Disabled   optional[bool]
+}
+
+type images struct {
+	logger       *zap.SugaredLogger
+	model        *model.Model
+	maxBodyBytes int64
+}
+
+func (c *images) listImages(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseImagesFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, err := c.model.Images(tenantOf(r), filter)
+	if err != nil {
+		c.logger.Error(err.Error())
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(page)
+}
+
+func parseImagesFilter(r *http.Request) (*model.ImagesFilter, error) {
+	query := r.URL.Query()
+	filter := &model.ImagesFilter{
+		UsedInPrefix: query.Get("usedInPrefix"),
+		Limit:        defaultImagesLimit,
+	}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxImagesLimit {
+			return nil, fmt.Errorf("Query parameter limit must be between 1 and %d", maxImagesLimit)
+		}
+
+		filter.Limit = limit
+	}
+
+	if value := query.Get("offset"); value != "" {
+		offset, err := strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			return nil, fmt.Errorf("Query parameter offset must not be negative")
+		}
+
+		filter.Offset = offset
+	}
+
+	for name, dest := range map[string]**time.Time{
+		"createdFrom": &filter.CreatedFrom,
+		"createdTo":   &filter.CreatedTo,
+	} {
+		if value := query.Get(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return nil, fmt.Errorf("Query parameter %s is not a RFC3339 timestamp", name)
+			}
+
+			*dest = &parsed
+		}
+	}
+
+	if value := query.Get("deleted"); value != "" {
+		deleted, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("Query parameter deleted must be a boolean")
+		}
+
+		filter.Deleted = deleted
+	}
+
+	return filter, nil
+}
+
+func (c *images) getImage(w http.ResponseWriter, r *http.Request) {
+	imageFkUUID, ok := parseImageVar(w, r)
+	if !ok {
+		return
+	}
+
+	image, err := c.model.Image(tenantOf(r), imageFkUUID)
+	c.writeImage(w, image, err)
+}
+
+func (c *images) updateImage(w http.ResponseWriter, r *http.Request) {
+	imageFkUUID, ok := parseImageVar(w, r)
+	if !ok {
+		return
+	}
+
+	var anImagePatch ImagePatch
+	err := decodeJSONBody(w, r, &anImagePatch, c.maxBodyBytes)
+	if err != nil {
+		var mr *malformedRequest
+		if errors.As(err, &mr) {
+			http.Error(w, mr.msg, mr.status)
+		} else {
+			c.logger.Error(err.Error())
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if (anImagePatch.UsedIn.Set && anImagePatch.UsedIn.Value == nil) ||
+		(anImagePatch.Disabled.Set && anImagePatch.Disabled.Value == nil) {
+		http.Error(w, "UsedIn and Disabled must not be null", http.StatusBadRequest)
+		return
+	}
+
+	image, err := c.model.UpdateImage(tenantOf(r), imageFkUUID, &model.ImageChanges{
+		UsedIn:          anImagePatch.UsedIn.Value,
+		Campaign:        anImagePatch.Campaign.Value,
+		ClearCampaign:   anImagePatch.Campaign.Set && anImagePatch.Campaign.Value == nil,
+		ActiveFrom:      anImagePatch.ActiveFrom.Value,
+		ClearActiveFrom: anImagePatch.ActiveFrom.Set && anImagePatch.ActiveFrom.Value == nil,
+		ExpiresAt:       anImagePatch.ExpiresAt.Value,
+		ClearExpiresAt:  anImagePatch.ExpiresAt.Set && anImagePatch.ExpiresAt.Value == nil,
+		Disabled:        anImagePatch.Disabled.Value,
+	})
+	c.writeImage(w, image, err)
+}
+
+func (c *images) deleteImage(w http.ResponseWriter, r *http.Request) {
+	imageFkUUID, ok := parseImageVar(w, r)
+	if !ok {
+		return
+	}
+
+	err := c.model.DeleteImage(tenantOf(r), imageFkUUID)
+	if errors.Is(err, model.ErrImageNotFound) {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	} else if err != nil {
+		c.logger.Error(err.Error())
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *images) restoreImage(w http.ResponseWriter, r *http.Request) {
+	imageFkUUID, ok := parseImageVar(w, r)
+	if !ok {
+		return
+	}
+
+	image, err := c.model.RestoreImage(tenantOf(r), imageFkUUID)
+	c.writeImage(w, image, err)
+}
+
+func (c *images) writeImage(w http.ResponseWriter, image *model.Image, err error) {
+	switch {
+	case errors.Is(err, model.ErrImageNotFound):
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	case errors.Is(err, model.ErrImageExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case errors.Is(err, model.ErrCampaignNotFound), errors.Is(err, model.ErrImageWindowInvalid):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, model.ErrTenantQuotaExceeded):
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	case err != nil:
+		c.logger.Error(err.Error())
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(image)
+}
+
+func parseImageVar(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	vars := mux.Vars(r)
+
+	imageFkUUID, err := uuid.Parse(vars["uuid"])
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return uuid.Nil, false
+	}
+
+	return imageFkUUID, true
+}
+
+func newImages(logger *logging.Logger, model *model.Model, maxBodyBytes int64) *images {
+	return &images{
+		logger:       logger.Log,
+		model:        model,
+		maxBodyBytes: maxBodyBytes,
+	}
+}
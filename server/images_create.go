@@ -1,24 +1,43 @@
 package server
 
 import (
+	"encoding/json"
 	"errors"
 	"fetch-me-if-you-read-me/imaginer"
 	logging "fetch-me-if-you-read-me/logger"
 	"fetch-me-if-you-read-me/model"
 
 	"fmt"
+	"html"
 	"net/http"
+	"time"
 
+	"github.com/google/uuid"
 	"go.uber.org/zap"
 )
 
+type ImageSnippets struct {
+	Html     string `json:"html"`
+	Markdown string `json:"markdown"`
+	Url      string `json:"url"`
+}
+
+type ImageCreated struct {
+	Id       string         `json:"id"`
+	Url      string         `json:"url"`
+	Snippets *ImageSnippets `json:"snippets"`
+}
+
 type ImageCreation struct {
-	UsedIn string
+	UsedIn     string
+	Campaign   *uuid.UUID
+	ActiveFrom *time.Time
+	ExpiresAt  *time.Time
 }
 
 func (c *imagesCreate) createImage(w http.ResponseWriter, r *http.Request) {
 	var anImageCreation ImageCreation
-	err := decodeJSONBody(w, r, &anImageCreation)
+	err := decodeJSONBody(w, r, &anImageCreation, c.maxBodyBytes)
 	if err != nil {
 		var mr *malformedRequest
 		if errors.As(err, &mr) {
@@ -30,30 +49,73 @@ func (c *imagesCreate) createImage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	uuid, err := c.model.PrepareImage(anImageCreation.UsedIn)
-	if err != nil {
+	if anImageCreation.ActiveFrom != nil && anImageCreation.ExpiresAt != nil &&
+		!anImageCreation.ActiveFrom.Before(*anImageCreation.ExpiresAt) {
+		http.Error(w, "ActiveFrom must precede ExpiresAt", http.StatusBadRequest)
+		return
+	}
+
+	uuid, err := c.model.PrepareImage(tenantOf(r), &model.ImageDefinition{
+		UsedIn:     anImageCreation.UsedIn,
+		Campaign:   anImageCreation.Campaign,
+		ActiveFrom: anImageCreation.ActiveFrom,
+		ExpiresAt:  anImageCreation.ExpiresAt,
+	})
+	if errors.Is(err, model.ErrCampaignNotFound) || errors.Is(err, model.ErrImageWindowInvalid) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if errors.Is(err, model.ErrTenantQuotaExceeded) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	} else if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	newLocation := fmt.Sprintf("images/%s", uuid.String())
+	newLocation := c.urls.pixelPath(*uuid, "")
+
+	if c.legacyRedirect {
+		w.Header().Add("Location", newLocation)
+		w.WriteHeader(http.StatusTemporaryRedirect)
+
+		w.Write([]byte(""))
+		return
+	}
 
-	w.Header().Add("Location", newLocation)
-	w.WriteHeader(http.StatusTemporaryRedirect)
+	pixelUrl := c.urls.absolute(r, newLocation)
+	width, height := c.imaginer.Size()
 
-	w.Write([]byte(""))
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", pixelUrl)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(&ImageCreated{
+		Id:  uuid.String(),
+		Url: pixelUrl,
+		Snippets: &ImageSnippets{
+			Html: fmt.Sprintf(`<img src="%s" width="%d" height="%d" alt="" style="display:block;border:0;width:%dpx;height:%dpx;">`,
+				html.EscapeString(pixelUrl), width, height, width, height),
+			Markdown: fmt.Sprintf("![](%s)", pixelUrl),
+			Url:      pixelUrl,
+		},
+	})
 }
 
 type imagesCreate struct {
-	logger   *zap.SugaredLogger
-	imaginer *imaginer.Imaginer
-	model    *model.Model
+	logger         *zap.SugaredLogger
+	imaginer       *imaginer.Imaginer
+	model          *model.Model
+	urls           *publicURLs
+	legacyRedirect bool
+	maxBodyBytes   int64
 }
 
-func newImagesCreate(logger *logging.Logger, imaginer *imaginer.Imaginer, model *model.Model) *imagesCreate {
+func newImagesCreate(logger *logging.Logger, imaginer *imaginer.Imaginer, model *model.Model, urls *publicURLs, legacyRedirect bool, maxBodyBytes int64) *imagesCreate {
 	return &imagesCreate{
-		logger:   logger.Log,
-		imaginer: imaginer,
-		model:    model,
+		logger:         logger.Log,
+		imaginer:       imaginer,
+		model:          model,
+		urls:           urls,
+		legacyRedirect: legacyRedirect,
+		maxBodyBytes:   maxBodyBytes,
 	}
 }
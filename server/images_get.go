@@ -2,22 +2,54 @@ package server
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
+	"fetch-me-if-you-read-me/classifier"
+	"fetch-me-if-you-read-me/deduplicator"
+	"fetch-me-if-you-read-me/geoip"
 	"fetch-me-if-you-read-me/imaginer"
 	logging "fetch-me-if-you-read-me/logger"
+	"fetch-me-if-you-read-me/metrics"
 	"fetch-me-if-you-read-me/model"
+	"fetch-me-if-you-read-me/useragent"
 
 	"image/jpeg"
+	"io"
 	"net/http"
+	"strconv"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 	"go.uber.org/zap"
 )
 
+// beaconMaxBytes bounds the JSON object a beacon may post.
+const beaconMaxBytes = 4096
+
+// Reasons a fetch is not stored for, besides the ones of the model.
+const (
+	fetchSkippedHead      = "head"
+	fetchSkippedSignature = "signature"
+	fetchSkippedRateLimit = "rate-limit"
+	fetchSkippedDuplicate = "duplicate"
+)
+
 type imagesGet struct {
-	logger   *zap.SugaredLogger
-	imaginer *imaginer.Imaginer
-	model    *model.Model
+	logger          *zap.SugaredLogger
+	imaginer        *imaginer.Imaginer
+	model           *model.Model
+	recipientTokens *recipientTokens
+	urls            *publicURLs
+	clientIPs       *clientIPs
+	headers         *headerCapture
+	limits          *limits
+	classifier      *classifier.Classifier
+	geoip           *geoip.Enricher
+	duplicates      deduplicator.Deduplicator
+	metrics         *metrics.Metrics
+	skipOutOfWindow bool
+	skipDuplicates  bool
+	ignoreHead      bool
 }
 
 func (c *imagesGet) imageGet(w http.ResponseWriter, r *http.Request) {
@@ -31,51 +63,159 @@ func (c *imagesGet) imageGet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-
-	image := c.imaginer.MakeImage()
-	buf := new(bytes.Buffer)
-	err = jpeg.Encode(buf, image.Image, &jpeg.Options{
-		Quality: 1,
-	})
+	var attributes json.RawMessage
+	if r.Method == http.MethodPost {
+		attributes, err = readBeaconAttributes(w, r)
+		if err != nil {
+			var mr *malformedRequest
+			if errors.As(err, &mr) {
+				http.Error(w, mr.msg, mr.status)
+			} else {
+				c.logger.Error(err.Error())
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			}
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	} else {
+		image := c.imaginer.MakeImage()
+		buf := new(bytes.Buffer)
+		err = jpeg.Encode(buf, image.Image, &jpeg.Options{
+			Quality: 1,
+		})
+
+		if err != nil {
+			c.logger.Errorf(err.Error())
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+		w.WriteHeader(http.StatusOK)
+		if r.Method != http.MethodHead {
+			w.Write(buf.Bytes())
+		}
+	}
 
-	if err != nil {
-		c.logger.Errorf(err.Error())
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	if r.Method == http.MethodHead && c.ignoreHead {
+		c.metrics.FetchSkipped(fetchSkippedHead)
 		return
 	}
-	w.Write(buf.Bytes())
 
-	meta := make(map[string]string)
-
-	for key := range r.Header {
-		meta[key] = r.Header.Get(key)
+	if !c.urls.verify(r, imageFkUUID) {
+		c.logger.Debugf("Not recording image %s fetch, its url signature is not valid", imageFk)
+		c.metrics.FetchSkipped(fetchSkippedSignature)
+		return
 	}
 
-	for key := range r.Trailer {
-		meta[key] = r.Trailer.Get(key)
+	if !c.limits.fetchAllowed(r) {
+		c.metrics.FetchSkipped(fetchSkippedRateLimit)
+		return
 	}
 
-	sourceAddr := meta["X-Real-Ip"]
+	meta := c.headers.capture(r)
+	meta["X-Remote-Addr"] = r.RemoteAddr
 
-	if sourceAddr == "" {
+	sourceAddr := ""
+	sourceIP := c.clientIPs.resolve(r)
+	if sourceIP != nil {
+		sourceAddr = sourceIP.String()
+	}
 
-		sourceAddr = meta["X-Forwarded-For"]
+	recipient := ""
+	if token, found := vars["recipientToken"]; found {
+		var valid bool
+		recipient, valid = c.recipientTokens.recipient(imageFkUUID, token)
+		if !valid {
+			c.logger.Warnf("Recipient token %s of image %s is not valid", token, imageFk)
+			recipient = ""
+		}
 	}
 
-	meta["X-Remote-Addr"] = r.RemoteAddr
+	// HEAD fetches are not opens, they must not turn the following GET into
+	// a duplicate. Mail proxies fetch for many recipients from the same
+	// address and user agent, so the recipient tells their opens apart.
+	duplicate := r.Method != http.MethodHead && c.duplicates != nil && c.duplicates.Seen(deduplicator.Fingerprint(imageFk, recipient, sourceAddr, r.UserAgent()))
+	if duplicate && c.skipDuplicates {
+		c.logger.Debugf("Not recording image %s fetch from %s, it repeats a recent one", imageFk, sourceAddr)
+		c.metrics.FetchSkipped(fetchSkippedDuplicate)
+		return
+	}
 
-	err = c.model.ImageFetched(imageFkUUID, sourceAddr, meta)
-	if err != nil {
+	fetch := &model.ImageFetch{
+		Image:           imageFkUUID,
+		Recipient:       recipient,
+		RemoteAddr:      sourceAddr,
+		Meta:            meta,
+		Category:        c.classifier.Classify(sourceIP, r.Header),
+		Client:          useragent.Parse(r.UserAgent()),
+		Location:        c.geoip.Lookup(sourceIP),
+		Duplicate:       duplicate,
+		Method:          r.Method,
+		Attributes:      attributes,
+		SkipOutOfWindow: c.skipOutOfWindow,
+	}
 
+	skipped, err := c.model.ImageFetched(fetch)
+	if err != nil {
+		c.metrics.FetchFailed()
 		c.logger.Error(err.Error())
+		return
+	}
+
+	if skipped != "" {
+		c.metrics.FetchSkipped(skipped)
+		return
 	}
+
+	c.metrics.FetchRecorded()
 }
 
-func newImagesGet(logger *logging.Logger, imaginer *imaginer.Imaginer, model *model.Model) *imagesGet {
+func newImagesGet(logger *logging.Logger, imaginer *imaginer.Imaginer, model *model.Model, recipientTokens *recipientTokens, urls *publicURLs, clientIPs *clientIPs, headers *headerCapture, limits *limits, classifier *classifier.Classifier, geoip *geoip.Enricher, duplicates deduplicator.Deduplicator, metrics *metrics.Metrics, skipOutOfWindow, skipDuplicates, ignoreHead bool) *imagesGet {
 	return &imagesGet{
-		logger:   logger.Log,
-		imaginer: imaginer,
-		model:    model,
+		logger:          logger.Log,
+		imaginer:        imaginer,
+		model:           model,
+		recipientTokens: recipientTokens,
+		urls:            urls,
+		clientIPs:       clientIPs,
+		headers:         headers,
+		limits:          limits,
+		classifier:      classifier,
+		geoip:           geoip,
+		duplicates:      duplicates,
+		metrics:         metrics,
+		skipOutOfWindow: skipOutOfWindow,
+		skipDuplicates:  skipDuplicates,
+		ignoreHead:      ignoreHead,
 	}
 }
+
+// readBeaconAttributes reads the optional JSON object posted by a beacon,
+// compacted.
+func readBeaconAttributes(w http.ResponseWriter, r *http.Request) (json.RawMessage, error) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, beaconMaxBytes))
+	if err != nil {
+		if err.Error() == "http: request body too large" {
+			msg := "Beacon payload must not be larger than " + strconv.Itoa(beaconMaxBytes) + " bytes"
+			return nil, &malformedRequest{status: http.StatusRequestEntityTooLarge, msg: msg}
+		}
+
+		return nil, err
+	}
+
+	if len(bytes.TrimSpace(body)) == 0 {
+
+		return nil, nil
+	}
+
+	var attributes map[string]interface{}
+	if err := json.Unmarshal(body, &attributes); err != nil || attributes == nil {
+		msg := "Beacon payload must be a JSON object"
+		return nil, &malformedRequest{status: http.StatusBadRequest, msg: msg}
+	}
+
+	return json.Marshal(attributes)
+}
@@ -0,0 +1,41 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadBeaconAttributes(t *testing.T) {
+	for body, expected := range map[string]string{
+		"":                           "",
+		"  ":                         "",
+		`{ "viewport": "390x844" }`:  `{"viewport":"390x844"}`,
+		`{"dark":true,"scroll":0.5}`: `{"dark":true,"scroll":0.5}`,
+	} {
+		r := httptest.NewRequest("POST", "/images/x", strings.NewReader(body))
+		attributes, err := readBeaconAttributes(httptest.NewRecorder(), r)
+
+		assert.Nil(t, err, "Error has to be nil for %q", body)
+		assert.Equal(t, expected, string(attributes), "Attributes have to be compacted from %q", body)
+	}
+
+	for body, status := range map[string]int{
+		`[1, 2]`:       http.StatusBadRequest,
+		`null`:         http.StatusBadRequest,
+		`{"viewport":`: http.StatusBadRequest,
+		`{"padding":"` + strings.Repeat("x", beaconMaxBytes) + `"}`: http.StatusRequestEntityTooLarge,
+	} {
+		r := httptest.NewRequest("POST", "/images/x", strings.NewReader(body))
+		_, err := readBeaconAttributes(httptest.NewRecorder(), r)
+
+		mr, ok := err.(*malformedRequest)
+		assert.True(t, ok, "Error has to be a malformed request for %.20q", body)
+		if ok {
+			assert.Equal(t, status, mr.status, "Status has to be %d for %.20q", status, body)
+		}
+	}
+}
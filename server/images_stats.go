@@ -0,0 +1,131 @@
+package server
+
+import (
+	"encoding/json"
+	"fetch-me-if-you-read-me/classifier"
+	logging "fetch-me-if-you-read-me/logger"
+	"fetch-me-if-you-read-me/model"
+
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultStatsWindow = 30 * 24 * time.Hour
+	// breakdownByClient is the breakdown query parameter value adding the
+	// fetches by client to stats.
+	breakdownByClient = "client"
+)
+
+type imagesStats struct {
+	logger *zap.SugaredLogger
+	model  *model.Model
+}
+
+func (c *imagesStats) imageStats(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	imageFk := vars["uuid"]
+
+	imageFkUUID, err := uuid.Parse(imageFk)
+	if err != nil {
+		c.logger.Errorf(err.Error())
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	filter, err := parseStatsFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	stats, err := c.model.ImageStats(tenantOf(r), imageFkUUID, filter)
+	if err != nil {
+		c.logger.Error(err.Error())
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(stats)
+}
+
+func parseStatsWindow(r *http.Request) (time.Time, time.Time, error) {
+	to := time.Now().UTC()
+	if value := r.URL.Query().Get("to"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("Query parameter to is not a RFC3339 timestamp")
+		}
+
+		to = parsed
+	}
+
+	from := to.Add(-defaultStatsWindow)
+	if value := r.URL.Query().Get("from"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("Query parameter from is not a RFC3339 timestamp")
+		}
+
+		from = parsed
+	}
+
+	if !from.Before(to) {
+		return time.Time{}, time.Time{}, fmt.Errorf("Query parameter from must precede to")
+	}
+
+	return from, to, nil
+}
+
+// parseStatsFilter reads the stats window, the categories, given as repeated
+// or comma separated category query parameters, and the breakdown.
+func parseStatsFilter(r *http.Request) (*model.StatsFilter, error) {
+	from, to, err := parseStatsWindow(r)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := &model.StatsFilter{
+		From: from,
+		To:   to,
+	}
+	for _, value := range r.URL.Query()["category"] {
+		for _, category := range strings.Split(value, ",") {
+			category = strings.TrimSpace(category)
+			if category == "" {
+				continue
+			}
+
+			if !classifier.IsCategory(category) {
+				return nil, fmt.Errorf("Query parameter category %s is not a known category", category)
+			}
+
+			filter.Categories = append(filter.Categories, category)
+		}
+	}
+
+	switch breakdown := r.URL.Query().Get("breakdown"); breakdown {
+	case "":
+	case breakdownByClient:
+		filter.ByClient = true
+	default:
+		return nil, fmt.Errorf("Query parameter breakdown %s is not supported, it can only be %s", breakdown, breakdownByClient)
+	}
+
+	return filter, nil
+}
+
+func newImagesStats(logger *logging.Logger, model *model.Model) *imagesStats {
+	return &imagesStats{
+		logger: logger.Log,
+		model:  model,
+	}
+}
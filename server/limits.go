@@ -0,0 +1,75 @@
+package server
+
+import (
+	"fetch-me-if-you-read-me/limiter"
+	logging "fetch-me-if-you-read-me/logger"
+
+	"math"
+	"net/http"
+	"strconv"
+
+	"go.uber.org/zap"
+)
+
+// limits applies the creation and fetch rate limits, each one is disabled
+// when its limiter is nil.
+type limits struct {
+	logger    *zap.SugaredLogger
+	clientIPs *clientIPs
+	create    limiter.Limiter
+	fetch     limiter.Limiter
+}
+
+// creation answers 429 once either the client or the api key it is using
+// runs out of creation tokens.
+func (l *limits) creation(next http.HandlerFunc) http.HandlerFunc {
+	if l.create == nil {
+
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		keys := []string{l.clientIPs.key(r)}
+		if apiKey := apiKeyOf(r); apiKey != nil {
+			keys = append(keys, "key:"+apiKey.Id.String())
+		}
+
+		for _, key := range keys {
+			allowed, wait := l.create.Take(key)
+			if !allowed {
+				l.logger.Debugf("Creation rate limit of %s hit on %s %s", key, r.Method, r.URL.Path)
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+				return
+			}
+		}
+
+		next(w, r)
+	}
+}
+
+// fetchAllowed tells whether the fetch r has to be recorded, the pixel is
+// served anyway.
+func (l *limits) fetchAllowed(r *http.Request) bool {
+	if l.fetch == nil {
+
+		return true
+	}
+
+	key := l.clientIPs.key(r)
+	allowed, _ := l.fetch.Take(key)
+	if !allowed {
+		l.logger.Debugf("Fetch rate limit of %s hit on %s", key, r.URL.Path)
+	}
+
+	return allowed
+}
+
+func newLimits(logger *logging.Logger, clientIPs *clientIPs, create, fetch limiter.Limiter) *limits {
+	return &limits{
+		logger:    logger.Log,
+		clientIPs: clientIPs,
+		create:    create,
+		fetch:     fetch,
+	}
+}
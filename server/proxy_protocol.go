@@ -0,0 +1,266 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// proxyHeaderTimeout bounds the time an upstream takes to send the PROXY
+	// protocol header of a connection.
+	proxyHeaderTimeout = 10 * time.Second
+	// proxyV1MaxLength is the longest v1 header, CRLF included.
+	proxyV1MaxLength = 107
+)
+
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// proxyListener reads the HAProxy PROXY protocol v1 or v2 header starting the
+// connections of its upstreams, and exposes the client address it carries
+// as the connection remote address. Connections from sources outside of
+// upstreams are refused.
+type proxyListener struct {
+	net.Listener
+	logger    *zap.SugaredLogger
+	upstreams []*net.IPNet
+}
+
+func newProxyListener(listener net.Listener, logger *zap.SugaredLogger, upstreams []*net.IPNet) *proxyListener {
+	return &proxyListener{
+		Listener:  listener,
+		logger:    logger,
+		upstreams: upstreams,
+	}
+}
+
+func (l *proxyListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+
+			return nil, err
+		}
+
+		if !containsIP(l.upstreams, parseHostIP(conn.RemoteAddr().String())) {
+			l.logger.Warnf("Refusing connection from %s, it is not a proxy protocol upstream", conn.RemoteAddr())
+			conn.Close()
+			continue
+		}
+
+		return &proxyConn{
+			Conn:   conn,
+			logger: l.logger,
+			reader: bufio.NewReaderSize(conn, 256),
+		}, nil
+	}
+}
+
+// proxyConn reads its header on first use, from the goroutine serving it
+// rather than the accepting one. The server sets its read deadline before
+// that first use, so the header deadline only applies when earlier and the
+// server one is put back once the header is read.
+type proxyConn struct {
+	net.Conn
+	logger     *zap.SugaredLogger
+	reader     *bufio.Reader
+	once       sync.Once
+	remoteAddr net.Addr
+	err        error
+	// deadlines guards the read deadlines, set from the goroutines of the
+	// server.
+	deadlines      sync.Mutex
+	readDeadline   time.Time
+	headerDeadline time.Time
+}
+
+func (c *proxyConn) readHeader() {
+	c.once.Do(func() {
+		c.remoteAddr = c.Conn.RemoteAddr()
+		c.setHeaderDeadline(time.Now().Add(proxyHeaderTimeout))
+		defer c.setHeaderDeadline(time.Time{})
+
+		address, err := readProxyHeader(c.reader)
+		if err != nil {
+			c.logger.Warnf("Reading proxy protocol header from %s went in error: %s", c.Conn.RemoteAddr(), err.Error())
+			c.err = err
+			c.Conn.Close()
+			return
+		}
+
+		if address != nil {
+			c.remoteAddr = address
+		}
+	})
+}
+
+func (c *proxyConn) setHeaderDeadline(deadline time.Time) {
+	c.deadlines.Lock()
+	defer c.deadlines.Unlock()
+
+	c.headerDeadline = deadline
+	c.applyReadDeadline()
+}
+
+// applyReadDeadline sets the earliest of the read deadlines on the
+// connection, deadlines must be locked.
+func (c *proxyConn) applyReadDeadline() error {
+	deadline := c.readDeadline
+	if !c.headerDeadline.IsZero() && (deadline.IsZero() || c.headerDeadline.Before(deadline)) {
+		deadline = c.headerDeadline
+	}
+
+	return c.Conn.SetReadDeadline(deadline)
+}
+
+func (c *proxyConn) SetReadDeadline(deadline time.Time) error {
+	c.deadlines.Lock()
+	defer c.deadlines.Unlock()
+
+	c.readDeadline = deadline
+	return c.applyReadDeadline()
+}
+
+func (c *proxyConn) SetDeadline(deadline time.Time) error {
+	if err := c.SetReadDeadline(deadline); err != nil {
+
+		return err
+	}
+
+	return c.Conn.SetWriteDeadline(deadline)
+}
+
+func (c *proxyConn) Read(b []byte) (int, error) {
+	c.readHeader()
+	if c.err != nil {
+
+		return 0, c.err
+	}
+
+	return c.reader.Read(b)
+}
+
+func (c *proxyConn) RemoteAddr() net.Addr {
+	c.readHeader()
+	return c.remoteAddr
+}
+
+// readProxyHeader reads a v1 or v2 header, returning the client address or
+// nil when the header does not carry one, as for health checks.
+func readProxyHeader(reader *bufio.Reader) (net.Addr, error) {
+	signature, err := reader.Peek(len(proxyV2Signature))
+	if err != nil {
+
+		return nil, fmt.Errorf("missing header: %w", err)
+	}
+
+	if bytes.Equal(signature, proxyV2Signature) {
+
+		return readProxyHeaderV2(reader)
+	}
+
+	if bytes.HasPrefix(signature, []byte("PROXY ")) {
+
+		return readProxyHeaderV1(reader)
+	}
+
+	return nil, errors.New("missing header")
+}
+
+func readProxyHeaderV1(reader *bufio.Reader) (net.Addr, error) {
+	line := make([]byte, 0, proxyV1MaxLength)
+	for !bytes.HasSuffix(line, []byte("\r\n")) {
+		if len(line) == proxyV1MaxLength {
+
+			return nil, errors.New("v1 header is too long")
+		}
+
+		b, err := reader.ReadByte()
+		if err != nil {
+
+			return nil, err
+		}
+
+		line = append(line, b)
+	}
+
+	fields := strings.Fields(string(line))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+
+		return nil, nil
+	}
+
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+
+		return nil, fmt.Errorf("v1 header %q is malformed", strings.TrimSpace(string(line)))
+	}
+
+	ip := net.ParseIP(fields[2])
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if ip == nil || err != nil || (fields[1] == "TCP4") != (ip.To4() != nil) {
+
+		return nil, fmt.Errorf("v1 header %q has a malformed source", strings.TrimSpace(string(line)))
+	}
+
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+func readProxyHeaderV2(reader *bufio.Reader) (net.Addr, error) {
+	header := make([]byte, len(proxyV2Signature)+4)
+	if _, err := io.ReadFull(reader, header); err != nil {
+
+		return nil, err
+	}
+
+	versionCommand, family := header[12], header[13]
+	length := int(binary.BigEndian.Uint16(header[14:16]))
+	if versionCommand>>4 != 2 {
+
+		return nil, fmt.Errorf("v2 header has version %d", versionCommand>>4)
+	}
+
+	addresses := make([]byte, length)
+	if _, err := io.ReadFull(reader, addresses); err != nil {
+
+		return nil, err
+	}
+
+	switch versionCommand & 0x0f {
+	case 0x0:
+		// LOCAL connections come from the upstream itself.
+		return nil, nil
+	case 0x1:
+	default:
+		return nil, fmt.Errorf("v2 header has command %d", versionCommand&0x0f)
+	}
+
+	switch family >> 4 {
+	case 0x1:
+		if length < 12 {
+
+			return nil, errors.New("v2 header ipv4 addresses are truncated")
+		}
+
+		return &net.TCPAddr{IP: net.IP(addresses[0:4]), Port: int(binary.BigEndian.Uint16(addresses[8:10]))}, nil
+	case 0x2:
+		if length < 36 {
+
+			return nil, errors.New("v2 header ipv6 addresses are truncated")
+		}
+
+		return &net.TCPAddr{IP: net.IP(addresses[0:16]), Port: int(binary.BigEndian.Uint16(addresses[32:34]))}, nil
+	default:
+		// Unspecified or unix addresses tell nothing about the client.
+		return nil, nil
+	}
+}
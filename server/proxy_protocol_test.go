@@ -0,0 +1,131 @@
+package server
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestReadProxyHeader(t *testing.T) {
+	for header, expected := range map[string]string{
+		"PROXY TCP4 198.51.100.1 10.0.0.1 4711 80\r\nGET":                                           "198.51.100.1:4711",
+		"PROXY TCP6 2001:db8::1 2001:db8::2 4711 80\r\nGET":                                         "[2001:db8::1]:4711",
+		"PROXY UNKNOWN\r\nGET":                                                                      "",
+		"\r\n\r\n\x00\r\nQUIT\n\x21\x11\x00\x0c\xc6\x33\x64\x01\x0a\x00\x00\x01\x12\x67\x00\x50GET": "198.51.100.1:4711",
+		"\r\n\r\n\x00\r\nQUIT\n\x20\x00\x00\x00GET":                                                 "",
+	} {
+		reader := bufio.NewReader(strings.NewReader(header))
+		address, err := readProxyHeader(reader)
+
+		assert.Nil(t, err, "Error has to be nil for %q", header)
+		if expected == "" {
+			assert.Nil(t, address, "Address has to be nil for %q", header)
+		} else {
+			assert.Equal(t, expected, address.String(), "Address has to be read from %q", header)
+		}
+
+		rest, _ := io.ReadAll(reader)
+		assert.Equal(t, "GET", string(rest), "Header has to be consumed from %q", header)
+	}
+
+	for _, header := range []string{
+		"GET / HTTP/1.1\r\n\r\n",
+		"PROXY TCP4 198.51.100.1 10.0.0.1 4711\r\n",
+		"PROXY TCP4 2001:db8::1 10.0.0.1 4711 80\r\n",
+		"PROXY TCP4 198.51.100.1 10.0.0.1 4711 80 " + strings.Repeat("x", 100) + "\r\n",
+	} {
+		_, err := readProxyHeader(bufio.NewReader(strings.NewReader(header)))
+		assert.NotNil(t, err, "Error has to be not nil for %q", header)
+	}
+}
+
+func TestProxyListener(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err, "Error has to be nil")
+	defer listener.Close()
+
+	upstreams, _ := parseNetworks("127.0.0.1")
+	proxied := newProxyListener(listener, zap.NewNop().Sugar(), upstreams)
+
+	go func() {
+		client, err := net.Dial("tcp", listener.Addr().String())
+		if err != nil {
+			return
+		}
+		defer client.Close()
+
+		client.Write([]byte("PROXY TCP4 198.51.100.1 10.0.0.1 4711 80\r\nhello"))
+	}()
+
+	conn, err := proxied.Accept()
+	assert.Nil(t, err, "Error has to be nil")
+	defer conn.Close()
+
+	assert.Equal(t, "198.51.100.1:4711", conn.RemoteAddr().String(), "Remote address has to be the client one")
+	payload := make([]byte, 5)
+	_, err = io.ReadFull(conn, payload)
+	assert.Nil(t, err, "Error has to be nil")
+	assert.Equal(t, "hello", string(payload), "Payload has to follow the header")
+}
+
+func TestProxyListenerKeepsServerTimeouts(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err, "Error has to be nil")
+
+	upstreams, _ := parseNetworks("127.0.0.1")
+	httpServer := newHTTPServer(&ServerConfs{
+		ReadHeaderTimeout: 200 * time.Millisecond,
+	}, http.NotFoundHandler(), nil)
+	go httpServer.Serve(newProxyListener(listener, zap.NewNop().Sugar(), upstreams))
+	defer httpServer.Close()
+
+	client, err := net.Dial("tcp", listener.Addr().String())
+	assert.Nil(t, err, "Error has to be nil")
+	defer client.Close()
+
+	// The request line comes with the header, the rest of the request never
+	// does.
+	client.Write([]byte("PROXY TCP4 198.51.100.1 10.0.0.1 4711 80\r\nGET / HTTP/1.1\r\n"))
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	start := time.Now()
+	_, err = io.ReadAll(client)
+	assert.Nil(t, err, "Slow client has to be cut off by the server rather than time out")
+	assert.Less(t, time.Since(start), 2*time.Second, "Slow client has to be cut off by the read header timeout")
+}
+
+func TestProxyConnKeepsReadDeadline(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err, "Error has to be nil")
+	defer listener.Close()
+
+	upstreams, _ := parseNetworks("127.0.0.1")
+	proxied := newProxyListener(listener, zap.NewNop().Sugar(), upstreams)
+
+	client, err := net.Dial("tcp", listener.Addr().String())
+	assert.Nil(t, err, "Error has to be nil")
+	defer client.Close()
+
+	client.Write([]byte("PROXY TCP4 198.51.100.1 10.0.0.1 4711 80\r\nGET / HTTP/1.1\r\n"))
+	// Without the deadline the read would only end with the client.
+	time.AfterFunc(3*time.Second, func() { client.Close() })
+
+	conn, err := proxied.Accept()
+	assert.Nil(t, err, "Error has to be nil")
+	defer conn.Close()
+
+	// As the server does before reading the request, the header included.
+	conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+
+	start := time.Now()
+	_, err = io.ReadAll(io.LimitReader(conn, 1024))
+	assert.NotNil(t, err, "Slow client has to be cut off by the read deadline")
+	assert.Less(t, time.Since(start), 2*time.Second, "Read deadline has to outlive the header")
+}
@@ -0,0 +1,173 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	logging "fetch-me-if-you-read-me/logger"
+	"fetch-me-if-you-read-me/model"
+	"fetch-me-if-you-read-me/signer"
+	"fmt"
+
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+const maxRecipientLength = 255
+
+// recipientTokens turns recipients into the last path segment of a
+// per-recipient pixel url. Without a signer tokens are opaque mail-merge
+// values, with a signer they are "<recipient>.<signature>".
+type recipientTokens struct {
+	signer *signer.Signer
+}
+
+func (t *recipientTokens) token(imageFk uuid.UUID, recipient string) string {
+	if t.signer == nil {
+
+		return recipient
+	}
+
+	return recipient + "." + t.signer.Sign(imageFk.String(), recipient)
+}
+
+func (t *recipientTokens) recipient(imageFk uuid.UUID, token string) (string, bool) {
+	if token == "" || len(token) > maxRecipientLength+32 {
+
+		return "", false
+	}
+
+	if t.signer == nil {
+
+		return token, len(token) <= maxRecipientLength
+	}
+
+	separator := strings.LastIndex(token, ".")
+	if separator < 1 {
+
+		return "", false
+	}
+
+	recipient, signature := token[:separator], token[separator+1:]
+	if !t.signer.Verify(signature, imageFk.String(), recipient) {
+
+		return "", false
+	}
+
+	return recipient, true
+}
+
+type RecipientsCreation struct {
+	Recipients []string
+}
+
+type RecipientToken struct {
+	Recipient string `json:"recipient"`
+	Token     string `json:"token"`
+	Path      string `json:"path"`
+	Url       string `json:"url"`
+}
+
+type recipients struct {
+	logger       *zap.SugaredLogger
+	model        *model.Model
+	tokens       *recipientTokens
+	urls         *publicURLs
+	maxBodyBytes int64
+}
+
+func (c *recipients) createRecipients(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	imageFkUUID, err := uuid.Parse(vars["uuid"])
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	// Tokens are only signed for images of the tenant, or any create key
+	// could mint valid opens for images of others.
+	_, err = c.model.Image(tenantOf(r), imageFkUUID)
+	if errors.Is(err, model.ErrImageNotFound) {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	} else if err != nil {
+		c.logger.Error(err.Error())
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	var aRecipientsCreation RecipientsCreation
+	err = decodeJSONBody(w, r, &aRecipientsCreation, c.maxBodyBytes)
+	if err != nil {
+		var mr *malformedRequest
+		if errors.As(err, &mr) {
+			http.Error(w, mr.msg, mr.status)
+		} else {
+			c.logger.Error(err.Error())
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	tokens := make([]*RecipientToken, 0, len(aRecipientsCreation.Recipients))
+	for _, recipient := range aRecipientsCreation.Recipients {
+		if recipient == "" || len(recipient) > maxRecipientLength || strings.Contains(recipient, "/") {
+			http.Error(w, fmt.Sprintf("Recipient %q must be between 1 and %d characters and must not contain /", recipient, maxRecipientLength), http.StatusBadRequest)
+			return
+		}
+
+		token := c.tokens.token(imageFkUUID, recipient)
+		path := c.urls.pixelPath(imageFkUUID, token)
+		tokens = append(tokens, &RecipientToken{
+			Recipient: recipient,
+			Token:     token,
+			Path:      path,
+			Url:       c.urls.absolute(r, path),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(tokens)
+}
+
+func (c *recipients) listRecipients(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	imageFkUUID, err := uuid.Parse(vars["uuid"])
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	from, to, err := parseStatsWindow(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	recipients, err := c.model.ImageRecipients(tenantOf(r), imageFkUUID, from, to)
+	if err != nil {
+		c.logger.Error(err.Error())
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(recipients)
+}
+
+func newRecipients(logger *logging.Logger, model *model.Model, tokens *recipientTokens, urls *publicURLs, maxBodyBytes int64) *recipients {
+	return &recipients{
+		logger:       logger.Log,
+		model:        model,
+		tokens:       tokens,
+		urls:         urls,
+		maxBodyBytes: maxBodyBytes,
+	}
+}
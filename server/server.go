@@ -1,26 +1,99 @@
 package server
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fetch-me-if-you-read-me/classifier"
+	"fetch-me-if-you-read-me/deduplicator"
+	"fetch-me-if-you-read-me/geoip"
 	"fetch-me-if-you-read-me/imaginer"
+	"fetch-me-if-you-read-me/limiter"
 	logging "fetch-me-if-you-read-me/logger"
+	"fetch-me-if-you-read-me/metrics"
 	"fetch-me-if-you-read-me/model"
+	"fetch-me-if-you-read-me/signer"
 	"fmt"
 
+	"net"
 	"net/http"
+	"time"
 
 	"github.com/gorilla/mux"
 	"go.uber.org/zap"
 )
 
+const (
+	OutOfWindowRecord = "record"
+	OutOfWindowSkip   = "skip"
+	DuplicatesMark    = "mark"
+	DuplicatesSkip    = "skip"
+	HeadRecord        = "record"
+	HeadIgnore        = "ignore"
+)
+
 type ServerConfs struct {
-	Host string
-	Port string
+	Host                   string
+	Port                   string
+	SignedRecipients       bool
+	RecipientSecret        string
+	RecipientSigningKeys   string
+	OutOfWindowPolicy      string
+	PublicBaseUrl          string
+	LegacyCreateRedirect   bool
+	UrlSigningKeys         string
+	RequireApiKeys         bool
+	RateLimitMode          string
+	CreateRateLimit        *limiter.Rate
+	FetchRateLimit         *limiter.Rate
+	ClassificationRules    string
+	GeoipCityDatabase      string
+	GeoipAsnDatabase       string
+	TrustedProxies         string
+	ClientIPHeader         string
+	ProxyProtocol          bool
+	ProxyProtocolUpstreams string
+	HeaderCapturePreset    string
+	HeaderCaptureAllow     string
+	HeaderCaptureDeny      string
+	HeaderCaptureRedact    string
+	HeaderCaptureMaxLength int
+	DedupMode              string
+	DedupWindow            time.Duration
+	DuplicatesPolicy       string
+	HeadPolicy             string
+	ShutdownTimeout        time.Duration
+	TlsCertificate         string
+	TlsKey                 string
+	TlsMinVersion          string
+	TlsCipherSuites        string
+	ReadTimeout            time.Duration
+	ReadHeaderTimeout      time.Duration
+	WriteTimeout           time.Duration
+	IdleTimeout            time.Duration
+	MaxHeaderBytes         int
+	MaxConnections         int
+	MaxBodyBytes           int64
+	MetricsPort            string
 }
 
 type Server struct {
 	mux.Router
-	listenString string
-	logger       *zap.SugaredLogger
+	listenString    string
+	logger          *zap.SugaredLogger
+	proxyProtocol   bool
+	proxyUpstreams  []*net.IPNet
+	httpServer      *http.Server
+	shutdownTimeout time.Duration
+	// closing is closed when the shutdown starts, to end the streams that
+	// would otherwise hold it until its deadline.
+	closing        chan struct{}
+	certificates   *certificates
+	maxConnections int
+	// adminServer serves the metrics apart when they have their own port.
+	adminServer *http.Server
+	classifier  *classifier.Classifier
+	geoip       *geoip.Enricher
 }
 
 func New(confs *ServerConfs, logger *logging.Logger, imaginer *imaginer.Imaginer, model *model.Model) (*Server, error) {
@@ -29,35 +102,402 @@ func New(confs *ServerConfs, logger *logging.Logger, imaginer *imaginer.Imaginer
 		*mux.NewRouter(),
 		listenString,
 		logger.Log,
+		confs.ProxyProtocol,
+		nil,
+		nil,
+		confs.ShutdownTimeout,
+		make(chan struct{}),
+		nil,
+		confs.MaxConnections,
+		nil,
+		nil,
+		nil,
+	}
+
+	if confs.OutOfWindowPolicy != OutOfWindowRecord && confs.OutOfWindowPolicy != OutOfWindowSkip {
+
+		return nil, fmt.Errorf("out of window policy must be %s or %s", OutOfWindowRecord, OutOfWindowSkip)
+	}
+
+	if confs.DuplicatesPolicy != DuplicatesMark && confs.DuplicatesPolicy != DuplicatesSkip {
+
+		return nil, fmt.Errorf("duplicates policy must be %s or %s", DuplicatesMark, DuplicatesSkip)
+	}
+
+	if confs.HeadPolicy != HeadRecord && confs.HeadPolicy != HeadIgnore {
+
+		return nil, fmt.Errorf("head policy must be %s or %s", HeadRecord, HeadIgnore)
+	}
+
+	if confs.ShutdownTimeout <= 0 {
+
+		return nil, fmt.Errorf("shutdown timeout must be positive")
+	}
+
+	if confs.ReadTimeout < 0 || confs.ReadHeaderTimeout < 0 || confs.WriteTimeout < 0 || confs.IdleTimeout < 0 {
+
+		return nil, fmt.Errorf("read, read header, write and idle timeouts must not be negative")
+	}
+
+	if confs.MaxHeaderBytes < 0 || confs.MaxConnections < 0 || confs.MaxBodyBytes <= 0 {
+
+		return nil, fmt.Errorf("max header bytes and connections must not be negative, max body bytes must be positive")
+	}
+
+	tokens := &recipientTokens{}
+	if confs.SignedRecipients {
+		var recipientSigner *signer.Signer
+		var err error
+		if confs.RecipientSigningKeys != "" {
+			recipientSigner, err = signer.NewKeyRing(confs.RecipientSigningKeys, confs.RecipientSecret)
+		} else {
+			recipientSigner, err = signer.New(confs.RecipientSecret)
+		}
+
+		if err != nil {
+
+			return nil, err
+		}
+
+		tokens.signer = recipientSigner
+	}
+
+	var urlSigner *signer.Signer
+	if confs.UrlSigningKeys != "" {
+		keys, err := signer.NewKeyRing(confs.UrlSigningKeys, "")
+		if err != nil {
+
+			return nil, err
+		}
+
+		urlSigner = keys
+	}
+
+	urls, err := newPublicURLs(confs.PublicBaseUrl, urlSigner)
+	if err != nil {
+
+		return nil, err
+	}
+
+	proxyUpstreams, err := parseNetworks(confs.ProxyProtocolUpstreams)
+	if err != nil {
+
+		return nil, fmt.Errorf("proxy protocol upstreams: %w", err)
+	}
+
+	if confs.ProxyProtocol && len(proxyUpstreams) == 0 {
+
+		return nil, fmt.Errorf("proxy protocol needs the cidrs of its upstreams")
+	}
+
+	router.proxyUpstreams = proxyUpstreams
+
+	clientIPs, err := newClientIPs(confs.TrustedProxies, confs.ClientIPHeader)
+	if err != nil {
+
+		return nil, err
+	}
+
+	headers, err := newHeaderCapture(confs.HeaderCapturePreset, confs.HeaderCaptureAllow, confs.HeaderCaptureDeny, confs.HeaderCaptureRedact, confs.HeaderCaptureMaxLength)
+	if err != nil {
+
+		return nil, err
+	}
+
+	createLimiter, err := limiter.New("create", confs.RateLimitMode, confs.CreateRateLimit, logger, model)
+	if err != nil {
+
+		return nil, err
+	}
+
+	fetchLimiter, err := limiter.New("fetch", confs.RateLimitMode, confs.FetchRateLimit, logger, model)
+	if err != nil {
+
+		return nil, err
+	}
+
+	fetchClassifier, err := classifier.New(confs.ClassificationRules, logger)
+	if err != nil {
+
+		return nil, err
+	}
+
+	duplicates, err := deduplicator.New(confs.DedupMode, confs.DedupWindow, logger, model)
+	if err != nil {
+
+		return nil, err
+	}
+
+	geoipEnricher, err := geoip.New(confs.GeoipCityDatabase, confs.GeoipAsnDatabase, logger)
+	if err != nil {
+
+		return nil, err
 	}
 
+	router.classifier = fetchClassifier
+	router.geoip = geoipEnricher
+
+	serverMetrics := metrics.New(model)
+
 	logger.Log.Debugf("Creating server on %s ...", listenString)
-	createImage := newImagesCreate(logger, imaginer, model)
-	imageGet := newImagesGet(logger, imaginer, model)
+	rateLimits := newLimits(logger, clientIPs, createLimiter, fetchLimiter)
+	createImage := newImagesCreate(logger, imaginer, model, urls, confs.LegacyCreateRedirect, confs.MaxBodyBytes)
+	imageGet := newImagesGet(logger, imaginer, model, tokens, urls, clientIPs, headers, rateLimits, fetchClassifier, geoipEnricher, duplicates, serverMetrics, confs.OutOfWindowPolicy == OutOfWindowSkip, confs.DuplicatesPolicy == DuplicatesSkip, confs.HeadPolicy == HeadIgnore)
+	recipientsHandlers := newRecipients(logger, model, tokens, urls, confs.MaxBodyBytes)
+	imageStats := newImagesStats(logger, model)
+	imagesHandlers := newImages(logger, model, confs.MaxBodyBytes)
 	statusHandlerFunc := newStatus(logger, model)
+	eventsHandlerFunc := newEvents(logger, model, router.closing)
+	webhooksHandlers := newWebhooks(logger, model, confs.MaxBodyBytes)
+	campaignsHandlers := newCampaigns(logger, model, confs.MaxBodyBytes)
+	auth := newAuthentication(logger, model, confs.RequireApiKeys)
+
+	// Requests are measured first, so that the ones refused by the
+	// authentication are too.
+	router.Use(serverMetrics.Instrument)
+	router.NotFoundHandler = serverMetrics.Instrument(http.NotFoundHandler())
+	router.MethodNotAllowedHandler = serverMetrics.Instrument(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}))
+
+	// Routes protected with a scope are the management ones, the pixel and the
+	// liveness probe stay public.
+	router.Use(auth.middleware)
 
 	router.
 		Methods("GET").
 		Path("/live").
 		HandlerFunc(statusHandlerFunc.statusHandler)
 
-	router.
+	if confs.MetricsPort == "" {
+		auth.protect(router.
+			Methods("GET").
+			Path("/metrics"), scopeAdmin).
+			Handler(serverMetrics.Handler())
+	} else {
+		admin := http.NewServeMux()
+		admin.Handle("/metrics", serverMetrics.Handler())
+		router.adminServer = &http.Server{
+			Addr:              fmt.Sprintf("%s:%s", confs.Host, confs.MetricsPort),
+			Handler:           admin,
+			ReadHeaderTimeout: confs.ReadHeaderTimeout,
+		}
+	}
+
+	auth.protect(router.
+		Methods("GET").
+		Path("/events"), scopeRead).
+		HandlerFunc(eventsHandlerFunc.eventsHandler)
+
+	auth.protect(router.
 		Path("/images").
-		Methods("POST").
-		HandlerFunc(createImage.createImage)
+		Methods("POST"), scopeCreate).
+		HandlerFunc(rateLimits.creation(createImage.createImage))
+
+	auth.protect(router.
+		Path("/images").
+		Methods("GET"), scopeRead).
+		HandlerFunc(imagesHandlers.listImages)
+
+	// The pixel is served on GET /images/{uuid}, so the management lookup
+	// has a path of its own.
+	auth.protect(router.Path("/images/{uuid}/meta").
+		Methods("GET"), scopeRead).
+		HandlerFunc(imagesHandlers.getImage)
+
+	auth.protect(router.Path("/images/{uuid}").
+		Methods("PATCH"), scopeAdmin).
+		HandlerFunc(imagesHandlers.updateImage)
+
+	auth.protect(router.Path("/images/{uuid}").
+		Methods("DELETE"), scopeAdmin).
+		HandlerFunc(imagesHandlers.deleteImage)
+
+	auth.protect(router.Path("/images/{uuid}/restore").
+		Methods("POST"), scopeAdmin).
+		HandlerFunc(imagesHandlers.restoreImage)
 
 	router.Path("/images/{uuid}").
 		Methods("HEAD", "GET", "POST").
 		HandlerFunc(imageGet.imageGet)
 
+	router.Path("/images/{uuid}/r/{recipientToken}").
+		Methods("HEAD", "GET", "POST").
+		HandlerFunc(imageGet.imageGet)
+
+	auth.protect(router.Path("/images/{uuid}/recipients").
+		Methods("POST"), scopeCreate).
+		HandlerFunc(rateLimits.creation(recipientsHandlers.createRecipients))
+
+	auth.protect(router.Path("/images/{uuid}/recipients").
+		Methods("GET"), scopeRead).
+		HandlerFunc(recipientsHandlers.listRecipients)
+
+	auth.protect(router.Path("/images/{uuid}/stats").
+		Methods("GET"), scopeRead).
+		HandlerFunc(imageStats.imageStats)
+
+	auth.protect(router.
+		Path("/campaigns").
+		Methods("POST"), scopeCreate).
+		HandlerFunc(rateLimits.creation(campaignsHandlers.createCampaign))
+
+	auth.protect(router.
+		Path("/campaigns").
+		Methods("GET"), scopeRead).
+		HandlerFunc(campaignsHandlers.listCampaigns)
+
+	auth.protect(router.
+		Path("/campaigns/{uuid}").
+		Methods("GET"), scopeRead).
+		HandlerFunc(campaignsHandlers.getCampaign)
+
+	auth.protect(router.
+		Path("/campaigns/{uuid}/stats").
+		Methods("GET"), scopeRead).
+		HandlerFunc(campaignsHandlers.campaignStats)
+
+	auth.protect(router.
+		Path("/webhooks").
+		Methods("POST"), scopeAdmin).
+		HandlerFunc(webhooksHandlers.createWebhook)
+
+	auth.protect(router.
+		Path("/webhooks").
+		Methods("GET"), scopeAdmin).
+		HandlerFunc(webhooksHandlers.listWebhooks)
+
+	auth.protect(router.
+		Path("/webhooks/{uuid}").
+		Methods("DELETE"), scopeAdmin).
+		HandlerFunc(webhooksHandlers.deleteWebhook)
+
+	var tlsConfig *tls.Config
+	if confs.TlsCertificate != "" || confs.TlsKey != "" {
+		if confs.TlsCertificate == "" || confs.TlsKey == "" {
+
+			return nil, fmt.Errorf("tls needs both a certificate and a key")
+		}
+
+		router.certificates, err = newCertificates(confs.TlsCertificate, confs.TlsKey, logger.Log)
+		if err != nil {
+
+			return nil, err
+		}
+
+		tlsConfig, err = newTLSConfig(router.certificates, confs.TlsMinVersion, confs.TlsCipherSuites)
+		if err != nil {
+
+			return nil, err
+		}
+	}
+
+	router.httpServer = newHTTPServer(confs, router, tlsConfig)
+	router.httpServer.RegisterOnShutdown(func() {
+		close(router.closing)
+	})
+
 	return router, nil
 }
 
+// newHTTPServer builds the server of handler with the timeouts and sizes of
+// confs. Zero timeouts and max header bytes keep the net/http defaults: no
+// timeout and 1MB of headers.
+func newHTTPServer(confs *ServerConfs, handler http.Handler, tlsConfig *tls.Config) *http.Server {
+	return &http.Server{
+		Handler:           handler,
+		TLSConfig:         tlsConfig,
+		ReadTimeout:       confs.ReadTimeout,
+		ReadHeaderTimeout: confs.ReadHeaderTimeout,
+		WriteTimeout:      confs.WriteTimeout,
+		IdleTimeout:       confs.IdleTimeout,
+		MaxHeaderBytes:    confs.MaxHeaderBytes,
+	}
+}
+
 func (server *Server) Listen() error {
-	err := http.ListenAndServe(server.listenString, server)
+	listener, err := net.Listen("tcp", server.listenString)
+	if err != nil {
+		return err
+	}
+
+	if server.adminServer != nil {
+		adminListener, err := net.Listen("tcp", server.adminServer.Addr)
+		if err != nil {
+			listener.Close()
+			return err
+		}
+
+		server.logger.Infof("Serving metrics on %s...", server.adminServer.Addr)
+		go func() {
+			if err := server.adminServer.Serve(adminListener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				server.logger.Errorf("Serving metrics went in error: %s", err.Error())
+			}
+		}()
+	}
+
+	if server.maxConnections > 0 {
+		listener = newLimitListener(listener, server.maxConnections)
+	}
+
+	if server.proxyProtocol {
+		listener = newProxyListener(listener, server.logger, server.proxyUpstreams)
+	}
+
+	if server.certificates != nil {
+		// The certificate comes from the configuration, so no files are
+		// given here.
+		server.logger.Infof("Listening with tls on server %s...", server.listenString)
+		err = server.httpServer.ServeTLS(listener, "", "")
+	} else {
+		server.logger.Infof("Listening on server %s...", server.listenString)
+		err = server.httpServer.Serve(listener)
+	}
+
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
+
+// ReloadCertificate reads the tls certificate and key files again, a pair
+// that fails to load leaves the previous one in place.
+func (server *Server) ReloadCertificate() {
+	if server.certificates != nil {
+		server.certificates.reload()
+	}
+}
+
+// Close stops watching the files of the classification rules, geoip
+// databases and tls certificate.
+func (server *Server) Close() {
+	server.classifier.Close()
+	server.geoip.Close()
+	if server.certificates != nil {
+		server.certificates.close()
+	}
+}
+
+// Shutdown stops accepting connections and waits for the requests in flight,
+// fetch recordings included, up to the shutdown timeout. Connections still
+// open past it are closed.
+func (server *Server) Shutdown() error {
+	ctx, cancel := context.WithTimeout(context.Background(), server.shutdownTimeout)
+	defer cancel()
+
+	if server.adminServer != nil {
+		server.adminServer.Close()
+	}
+
+	server.logger.Infof("Draining requests for up to %s...", server.shutdownTimeout)
+	err := server.httpServer.Shutdown(ctx)
 	if err != nil {
+		server.logger.Warnf("Draining requests went in error, closing the remaining connections: %s", err.Error())
+		server.httpServer.Close()
 		return err
 	}
-	server.logger.Infof("Listening on server %s...", server.listenString)
+
+	server.logger.Info("Requests drained")
 	return nil
 }
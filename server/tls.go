@@ -0,0 +1,135 @@
+package server
+
+import (
+	"crypto/tls"
+	"fetch-me-if-you-read-me/watcher"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// certificateCheckPeriod is how often the certificate files are checked for
+// changes.
+const certificateCheckPeriod = 30 * time.Second
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// certificates serves the certificate read from its files, reloaded when
+// either file changes or on demand. A pair that fails to load leaves the
+// previous certificate in place.
+type certificates struct {
+	sync.RWMutex
+	logger      *zap.SugaredLogger
+	certPath    string
+	keyPath     string
+	certificate *tls.Certificate
+	watcher     *watcher.Watcher
+}
+
+func newCertificates(certPath, keyPath string, logger *zap.SugaredLogger) (*certificates, error) {
+	c := &certificates{
+		logger:   logger,
+		certPath: certPath,
+		keyPath:  keyPath,
+	}
+
+	if err := c.load(); err != nil {
+
+		return nil, err
+	}
+
+	c.watcher = watcher.New("tls certificate "+certPath, []string{certPath, keyPath}, certificateCheckPeriod, c.load, logger)
+	return c, nil
+}
+
+func (c *certificates) load() error {
+	certificate, err := tls.LoadX509KeyPair(c.certPath, c.keyPath)
+	if err != nil {
+
+		return fmt.Errorf("tls certificate %s: %w", c.certPath, err)
+	}
+
+	c.Lock()
+	c.certificate = &certificate
+	c.Unlock()
+
+	c.logger.Infof("Loaded tls certificate from %s", c.certPath)
+	return nil
+}
+
+// reload loads the files again, whether they changed or not.
+func (c *certificates) reload() {
+	if err := c.load(); err != nil {
+		c.logger.Errorf("Reloading tls certificate went in error, keeping the previous one: %s", err.Error())
+	}
+}
+
+// close stops watching the files.
+func (c *certificates) close() {
+	c.watcher.Stop()
+}
+
+func (c *certificates) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.RLock()
+	defer c.RUnlock()
+
+	return c.certificate, nil
+}
+
+// newTLSConfig builds the configuration serving the certificates, with the
+// minVersion protocol version at least and, when not empty, only the comma
+// separated cipherSuites names for the versions up to 1.2.
+func newTLSConfig(certificates *certificates, minVersion, cipherSuites string) (*tls.Config, error) {
+	version, found := tlsVersions[minVersion]
+	if !found {
+
+		return nil, fmt.Errorf("tls min version must be one of 1.0, 1.1, 1.2 or 1.3")
+	}
+
+	suites, err := parseCipherSuites(cipherSuites)
+	if err != nil {
+
+		return nil, err
+	}
+
+	return &tls.Config{
+		MinVersion:     version,
+		CipherSuites:   suites,
+		GetCertificate: certificates.getCertificate,
+	}, nil
+}
+
+// parseCipherSuites returns the ids of the comma separated cipher suite
+// names, only the ones without known security issues are accepted.
+func parseCipherSuites(names string) ([]uint16, error) {
+	ids := map[string]uint16{}
+	for _, suite := range tls.CipherSuites() {
+		ids[suite.Name] = suite.ID
+	}
+
+	var suites []uint16
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		id, found := ids[name]
+		if !found {
+
+			return nil, fmt.Errorf("tls cipher suite %s is unknown or insecure", name)
+		}
+
+		suites = append(suites, id)
+	}
+
+	return suites, nil
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func writeCertificate(t *testing.T, dir, name string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err, "Error has to be nil")
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.Nil(t, err, "Error has to be nil")
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.Nil(t, err, "Error has to be nil")
+
+	certPath, keyPath := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+
+	return certPath, keyPath
+}
+
+func commonName(t *testing.T, c *certificates) string {
+	certificate, err := c.getCertificate(nil)
+	assert.Nil(t, err, "Error has to be nil")
+
+	leaf, err := x509.ParseCertificate(certificate.Certificate[0])
+	assert.Nil(t, err, "Error has to be nil")
+
+	return leaf.Subject.CommonName
+}
+
+func TestCertificatesReload(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := writeCertificate(t, dir, "first")
+
+	c, err := newCertificates(certPath, keyPath, zap.NewNop().Sugar())
+	assert.Nil(t, err, "Error has to be nil")
+	defer c.close()
+	assert.Equal(t, "first", commonName(t, c), "First certificate has to be served")
+
+	writeCertificate(t, dir, "second")
+	c.reload()
+	assert.Equal(t, "second", commonName(t, c), "Reloaded certificate has to be served")
+
+	os.WriteFile(keyPath, []byte("garbage"), 0600)
+	c.reload()
+	assert.Equal(t, "second", commonName(t, c), "Previous certificate has to be kept on errors")
+
+	writeCertificate(t, dir, "third")
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(certPath, later, later)
+	c.watcher.Check()
+	assert.Equal(t, "third", commonName(t, c), "Changed certificate has to be reloaded")
+
+	_, err = newCertificates(filepath.Join(dir, "missing.pem"), keyPath, zap.NewNop().Sugar())
+	assert.NotNil(t, err, "Error has to be not nil")
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	config, err := newTLSConfig(&certificates{}, "1.3", "")
+	assert.Nil(t, err, "Error has to be nil")
+	assert.Equal(t, uint16(tls.VersionTLS13), config.MinVersion, "Min version has to be parsed")
+	assert.Nil(t, config.CipherSuites, "Cipher suites have to be the default ones")
+
+	config, err = newTLSConfig(&certificates{}, "1.2", "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256")
+	assert.Nil(t, err, "Error has to be nil")
+	assert.Equal(t, []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256}, config.CipherSuites, "Cipher suites have to be parsed")
+
+	for _, test := range [][2]string{
+		{"1.4", ""},
+		{"1.2", "TLS_RSA_WITH_RC4_128_SHA"},
+		{"1.2", "TLS_MADE_UP"},
+	} {
+		_, err = newTLSConfig(&certificates{}, test[0], test[1])
+		assert.NotNil(t, err, "Error has to be not nil for %v", test)
+	}
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"fetch-me-if-you-read-me/signer"
+
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// signatureParameter is the query parameter carrying the pixel url signature.
+const signatureParameter = "s"
+
+// publicURLs builds absolute urls of the pixels. Without a configured public
+// base url, the base is derived from the request the url is built for. With a
+// signer, pixel urls carry a signature of the image they point to.
+type publicURLs struct {
+	base   *url.URL
+	signer *signer.Signer
+}
+
+func newPublicURLs(publicBaseUrl string, urlSigner *signer.Signer) (*publicURLs, error) {
+	if publicBaseUrl == "" {
+
+		return &publicURLs{
+			signer: urlSigner,
+		}, nil
+	}
+
+	base, err := url.Parse(publicBaseUrl)
+	if err != nil || (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" {
+
+		return nil, fmt.Errorf("public base url %s must be an absolute http or https url", publicBaseUrl)
+	}
+
+	base.Path = strings.TrimSuffix(base.Path, "/")
+	return &publicURLs{
+		base:   base,
+		signer: urlSigner,
+	}, nil
+}
+
+func (u *publicURLs) pixelPath(imageFk uuid.UUID, recipientToken string) string {
+	path := fmt.Sprintf("images/%s", imageFk.String())
+	if recipientToken != "" {
+		path += "/r/" + url.PathEscape(recipientToken)
+	}
+
+	if u.signer != nil {
+		path += "?" + signatureParameter + "=" + url.QueryEscape(u.signer.Sign(imageFk.String()))
+	}
+
+	return path
+}
+
+// verify tells whether the pixel request is signed for imageFk, requests are
+// always trusted when url signing is off.
+func (u *publicURLs) verify(r *http.Request, imageFk uuid.UUID) bool {
+	if u.signer == nil {
+
+		return true
+	}
+
+	return u.signer.Verify(r.URL.Query().Get(signatureParameter), imageFk.String())
+}
+
+func (u *publicURLs) absolute(r *http.Request, path string) string {
+	base := u.base
+	if base == nil {
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+
+		if forwardedProto := r.Header.Get("X-Forwarded-Proto"); forwardedProto == "http" || forwardedProto == "https" {
+			scheme = forwardedProto
+		}
+
+		base = &url.URL{
+			Scheme: scheme,
+			Host:   r.Host,
+		}
+	}
+
+	return base.String() + "/" + strings.TrimPrefix(path, "/")
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	logging "fetch-me-if-you-read-me/logger"
+	"fetch-me-if-you-read-me/model"
+
+	"net/http"
+	"net/url"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+type WebhookCreation struct {
+	Url            string
+	Image          *uuid.UUID
+	FirstFetchOnly bool
+	Secret         string
+}
+
+type webhooks struct {
+	logger       *zap.SugaredLogger
+	model        *model.Model
+	maxBodyBytes int64
+}
+
+func (c *webhooks) createWebhook(w http.ResponseWriter, r *http.Request) {
+	var aWebhookCreation WebhookCreation
+	err := decodeJSONBody(w, r, &aWebhookCreation, c.maxBodyBytes)
+	if err != nil {
+		var mr *malformedRequest
+		if errors.As(err, &mr) {
+			http.Error(w, mr.msg, mr.status)
+		} else {
+			c.logger.Error(err.Error())
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	target, err := url.Parse(aWebhookCreation.Url)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		http.Error(w, "Url must be an absolute http or https url", http.StatusBadRequest)
+		return
+	}
+
+	secret := aWebhookCreation.Secret
+	if secret == "" {
+		secretBytes := make([]byte, 32)
+		if _, err := rand.Read(secretBytes); err != nil {
+			c.logger.Error(err.Error())
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		secret = hex.EncodeToString(secretBytes)
+	}
+
+	webhook := &model.Webhook{
+		Image:          aWebhookCreation.Image,
+		Url:            target.String(),
+		Secret:         secret,
+		FirstFetchOnly: aWebhookCreation.FirstFetchOnly,
+	}
+	err = c.model.CreateWebhook(tenantOf(r), webhook)
+	if errors.Is(err, model.ErrImageNotFound) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if err != nil {
+		c.logger.Error(err.Error())
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(webhook)
+}
+
+func (c *webhooks) listWebhooks(w http.ResponseWriter, r *http.Request) {
+	webhooks, err := c.model.Webhooks(tenantOf(r))
+	if err != nil {
+		c.logger.Error(err.Error())
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(webhooks)
+}
+
+func (c *webhooks) deleteWebhook(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	webhookUUID, err := uuid.Parse(vars["uuid"])
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	err = c.model.DisableWebhook(tenantOf(r), webhookUUID)
+	if errors.Is(err, model.ErrWebhookNotFound) {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	} else if err != nil {
+		c.logger.Error(err.Error())
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func newWebhooks(logger *logging.Logger, model *model.Model, maxBodyBytes int64) *webhooks {
+	return &webhooks{
+		logger:       logger.Log,
+		model:        model,
+		maxBodyBytes: maxBodyBytes,
+	}
+}
@@ -0,0 +1,115 @@
+package signer
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	// signatureSize is the number of HMAC-SHA256 bytes kept in a signature,
+	// long enough to make forgery impractical while keeping urls short.
+	signatureSize = 16
+	// keyIdSeparator splits the key id from the mac in a signature, it is
+	// url-safe and outside of the base64url alphabet.
+	keyIdSeparator = "~"
+)
+
+// keyIdPattern keeps key ids url-safe and free of the separators of the
+// tokens embedding signatures.
+var keyIdPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Signer signs with its active key and verifies with any of its keys, so that
+// keys can be rotated by adding the new one first and retiring the old one
+// once the signatures it issued are no longer in use.
+type Signer struct {
+	keys   map[string][]byte
+	active string
+}
+
+// New signs with secret, taken verbatim, signatures are bare macs.
+func New(secret string) (*Signer, error) {
+	if secret == "" {
+
+		return nil, errors.New("signer secret must not be empty")
+	}
+
+	return &Signer{
+		keys: map[string][]byte{"": []byte(secret)},
+	}, nil
+}
+
+// NewKeyRing parses keys from "kid:secret,kid:secret", the first key being the
+// one signing, key ids being made of letters, digits, - and _. A legacy
+// secret, when not empty, keeps verifying the bare macs New signed with it,
+// so that a single secret can be rotated into a key ring.
+func NewKeyRing(keys, legacy string) (*Signer, error) {
+	if strings.TrimSpace(keys) == "" {
+
+		return nil, errors.New("signer keys must not be empty")
+	}
+
+	signer := &Signer{
+		keys: map[string][]byte{},
+	}
+
+	if legacy != "" {
+		signer.keys[""] = []byte(legacy)
+	}
+
+	for i, spec := range strings.Split(keys, ",") {
+		keyId, secret, found := strings.Cut(strings.TrimSpace(spec), ":")
+		if !found || secret == "" || !keyIdPattern.MatchString(keyId) {
+
+			return nil, fmt.Errorf("signer key %d must be formatted as kid:secret, kid being made of letters, digits, - and _", i+1)
+		}
+
+		if _, duplicated := signer.keys[keyId]; duplicated {
+
+			return nil, fmt.Errorf("signer key id %s is duplicated", keyId)
+		}
+
+		signer.keys[keyId] = []byte(secret)
+		if i == 0 {
+			signer.active = keyId
+		}
+	}
+
+	return signer, nil
+}
+
+func mac(secret []byte, parts []string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(strings.Join(parts, "/")))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:signatureSize])
+}
+
+func (s *Signer) Sign(parts ...string) string {
+	signature := mac(s.keys[s.active], parts)
+	if s.active == "" {
+
+		return signature
+	}
+
+	return s.active + keyIdSeparator + signature
+}
+
+func (s *Signer) Verify(signature string, parts ...string) bool {
+	keyId, signed, found := strings.Cut(signature, keyIdSeparator)
+	if !found {
+		keyId, signed = "", signature
+	}
+
+	secret, known := s.keys[keyId]
+	if !known {
+
+		return false
+	}
+
+	return hmac.Equal([]byte(signed), []byte(mac(secret, parts)))
+}
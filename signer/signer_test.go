@@ -0,0 +1,81 @@
+package signer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewWithoutSecret(t *testing.T) {
+	signer, err := New("")
+
+	assert.Nil(t, signer, "Signer has to be nil")
+	assert.NotNil(t, err, "Error has to be not nil")
+}
+
+func TestNewWithMalformedKeys(t *testing.T) {
+	signer, err := NewKeyRing("k1:secret,secret", "")
+
+	assert.Nil(t, signer, "Signer has to be nil")
+	assert.NotNil(t, err, "Error has to be not nil")
+
+	signer, err = NewKeyRing("k1:secret,k1:other", "")
+
+	assert.Nil(t, signer, "Signer has to be nil")
+	assert.NotNil(t, err, "Error has to be not nil on duplicated key ids")
+
+	signer, err = NewKeyRing("k.1:secret", "")
+
+	assert.Nil(t, signer, "Signer has to be nil")
+	assert.NotNil(t, err, "Error has to be not nil on key ids with token separators")
+}
+
+func TestNewKeepsLegacySecrets(t *testing.T) {
+	signer, err := New("kid:secret,with,commas")
+
+	assert.Nil(t, err, "Error has to be nil")
+
+	signature := signer.Sign("image")
+	assert.Len(t, signature, 22, "Legacy secrets have to sign bare macs")
+
+	rotated, err := NewKeyRing("k1:next", "kid:secret,with,commas")
+
+	assert.Nil(t, err, "Error has to be nil")
+	assert.True(t, rotated.Verify(signature, "image"), "Legacy signatures have to verify once rotated")
+	assert.Equal(t, "k1~", rotated.Sign("image")[:3], "Key ring has to sign with its first key")
+}
+
+func TestSignAndVerify(t *testing.T) {
+	signer, err := New("secret")
+
+	assert.NotNil(t, signer, "New signer has to be not nil")
+	assert.Nil(t, err, "Error has to be nil")
+
+	signature := signer.Sign("image", "recipient")
+
+	assert.Len(t, signature, 22, "Signature has to be 22 url-safe characters")
+	assert.True(t, signer.Verify(signature, "image", "recipient"), "Signature has to verify")
+	assert.False(t, signer.Verify(signature, "image", "another"), "Signature has to be bound to the signed parts")
+
+	other, _ := New("other")
+	assert.False(t, other.Verify(signature, "image", "recipient"), "Signature has to be bound to the secret")
+}
+
+func TestRotation(t *testing.T) {
+	previous, err := NewKeyRing("k1:first", "")
+
+	assert.Nil(t, err, "Error has to be nil")
+
+	rotated, err := NewKeyRing("k2:second,k1:first", "")
+
+	assert.Nil(t, err, "Error has to be nil")
+
+	previousSignature := previous.Sign("image")
+	rotatedSignature := rotated.Sign("image")
+
+	assert.Equal(t, "k1~", previousSignature[:3], "Signature has to carry its key id")
+	assert.Equal(t, "k2~", rotatedSignature[:3], "Signature has to be made with the first key")
+	assert.True(t, rotated.Verify(previousSignature, "image"), "Signature of a retained key has to verify")
+	assert.False(t, previous.Verify(rotatedSignature, "image"), "Signature of an unknown key must not verify")
+	assert.False(t, rotated.Verify("k3~"+rotatedSignature[3:], "image"), "Signature must not verify under another key id")
+}
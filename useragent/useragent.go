@@ -0,0 +1,148 @@
+package useragent
+
+import (
+	"regexp"
+	"strings"
+)
+
+const (
+	DeviceDesktop = "desktop"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceBot     = "bot"
+
+	// maxVersionLength is the size of the stored browser version, longer
+	// ones are cut rather than failing the fetch recording.
+	maxVersionLength = 64
+)
+
+// Client is what a user agent tells about the software fetching a pixel,
+// fields it does not tell are left empty.
+type Client struct {
+	Browser    string `json:"browser,omitempty"`
+	Version    string `json:"version,omitempty"`
+	Os         string `json:"os,omitempty"`
+	Device     string `json:"device,omitempty"`
+	MailClient string `json:"mailClient,omitempty"`
+}
+
+type pattern struct {
+	name       string
+	expression *regexp.Regexp
+}
+
+var (
+	// Mail clients fetching from their servers, whose user agent tells
+	// nothing about the reader browser and device.
+	mailProxies = []*pattern{
+		{"Gmail", regexp.MustCompile(`GoogleImageProxy`)},
+		{"Yahoo Mail", regexp.MustCompile(`YahooMailProxy`)},
+	}
+	// Mail clients fetching with their own token, checked in order.
+	mailClients = []*pattern{
+		{"Outlook", regexp.MustCompile(`(?i)Microsoft Outlook|MSOffice|ms-office|Outlook-iOS|Outlook-Android|OneOutlook`)},
+		{"Thunderbird", regexp.MustCompile(`Thunderbird/`)},
+		{"Windows Mail", regexp.MustCompile(`Windows-Mail|WindowsMail`)},
+	}
+	// Browsers checked in order, the ones including other browsers tokens
+	// first. The first submatch is the version.
+	browsers = []*pattern{
+		{"Edge", regexp.MustCompile(`Edg(?:e|A|iOS)?/([\d.]+)`)},
+		{"Opera", regexp.MustCompile(`OPR/([\d.]+)`)},
+		{"Samsung Internet", regexp.MustCompile(`SamsungBrowser/([\d.]+)`)},
+		{"Chrome", regexp.MustCompile(`(?:Chrome|CriOS)/([\d.]+)`)},
+		{"Firefox", regexp.MustCompile(`(?:Firefox|FxiOS)/([\d.]+)`)},
+		{"Safari", regexp.MustCompile(`Version/([\d.]+).*Safari/`)},
+		{"Internet Explorer", regexp.MustCompile(`MSIE ([\d.]+)|Trident/.*rv:([\d.]+)`)},
+	}
+	operatingSystems = []*pattern{
+		{"iOS", regexp.MustCompile(`iPhone|iPad|iPod`)},
+		{"Android", regexp.MustCompile(`Android`)},
+		{"Windows", regexp.MustCompile(`Windows`)},
+		{"macOS", regexp.MustCompile(`Macintosh|Mac OS X`)},
+		{"ChromeOS", regexp.MustCompile(`CrOS`)},
+		{"Linux", regexp.MustCompile(`Linux|X11`)},
+	}
+
+	bots = regexp.MustCompile(`(?i)bot\b|crawler|spider|curl/|wget/|python-requests|go-http-client|java/|okhttp|headless`)
+	// Apple Mail loads images with the bare WebKit user agent, without the
+	// Version and Safari tokens of the browser.
+	appleWebKit = regexp.MustCompile(`AppleWebKit/[\d.]+ \(KHTML, like Gecko\)(?: Mobile/\w+)?$`)
+)
+
+// Parse reads the browser, its version, the operating system, the device type
+// and the mail client from a user agent.
+func Parse(userAgent string) Client {
+	userAgent = strings.TrimSpace(userAgent)
+	client := Client{}
+	if userAgent == "" {
+
+		return client
+	}
+
+	for _, mailProxy := range mailProxies {
+		if mailProxy.expression.MatchString(userAgent) {
+			client.MailClient = mailProxy.name
+			return client
+		}
+	}
+
+	for _, mailClient := range mailClients {
+		if mailClient.expression.MatchString(userAgent) {
+			client.MailClient = mailClient.name
+			break
+		}
+	}
+
+	for _, browser := range browsers {
+		submatches := browser.expression.FindStringSubmatch(userAgent)
+		if submatches == nil {
+			continue
+		}
+
+		client.Browser = browser.name
+		for _, version := range submatches[1:] {
+			if version != "" {
+				if len(version) > maxVersionLength {
+					version = version[:maxVersionLength]
+				}
+
+				client.Version = version
+				break
+			}
+		}
+		break
+	}
+
+	for _, os := range operatingSystems {
+		if os.expression.MatchString(userAgent) {
+			client.Os = os.name
+			break
+		}
+	}
+
+	if client.MailClient == "" && (userAgent == "Mozilla/5.0" ||
+		((client.Os == "macOS" || client.Os == "iOS") && appleWebKit.MatchString(userAgent))) {
+		client.MailClient = "Apple Mail"
+	}
+
+	client.Device = device(userAgent, client.Os)
+	return client
+}
+
+func device(userAgent, os string) string {
+	switch {
+	case bots.MatchString(userAgent):
+		return DeviceBot
+	case strings.Contains(userAgent, "iPad") || strings.Contains(userAgent, "Tablet"):
+		return DeviceTablet
+	case os == "Android" && !strings.Contains(userAgent, "Mobile"):
+		return DeviceTablet
+	case os == "iOS" || os == "Android" || strings.Contains(userAgent, "Mobile"):
+		return DeviceMobile
+	case os != "":
+		return DeviceDesktop
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,69 @@
+package useragent
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	for userAgent, expected := range map[string]Client{
+		"Mozilla/5.0 (Windows NT 5.1; rv:11.0) Gecko Firefox/11.0 (via ggpht.com GoogleImageProxy)": {
+			MailClient: "Gmail",
+		},
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko)": {
+			Os:         "macOS",
+			Device:     DeviceDesktop,
+			MailClient: "Apple Mail",
+		},
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 16_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Mobile/15E148": {
+			Os:         "iOS",
+			Device:     DeviceMobile,
+			MailClient: "Apple Mail",
+		},
+		"Mozilla/4.0 (compatible; MSIE 7.0; Windows NT 10.0; WOW64; Trident/7.0; Microsoft Outlook 16.0.15601; ms-office; MSOffice 16)": {
+			Browser:    "Internet Explorer",
+			Version:    "7.0",
+			Os:         "Windows",
+			Device:     DeviceDesktop,
+			MailClient: "Outlook",
+		},
+		"Mozilla/5.0 (X11; Linux x86_64; rv:102.0) Gecko/20100101 Thunderbird/102.3.0": {
+			Os:         "Linux",
+			Device:     DeviceDesktop,
+			MailClient: "Thunderbird",
+		},
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/106.0.0.0 Safari/537.36 Edg/106.0.1370.47": {
+			Browser: "Edge",
+			Version: "106.0.1370.47",
+			Os:      "Windows",
+			Device:  DeviceDesktop,
+		},
+		"Mozilla/5.0 (Linux; Android 13; Pixel 7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/106.0.5249.126 Mobile Safari/537.36": {
+			Browser: "Chrome",
+			Version: "106.0.5249.126",
+			Os:      "Android",
+			Device:  DeviceMobile,
+		},
+		"Mozilla/5.0 (iPad; CPU OS 16_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.0 Mobile/15E148 Safari/604.1": {
+			Browser: "Safari",
+			Version: "16.0",
+			Os:      "iOS",
+			Device:  DeviceTablet,
+		},
+		"curl/7.85.0": {
+			Device: DeviceBot,
+		},
+		"": {},
+	} {
+		assert.Equal(t, expected, Parse(userAgent), "Client has to be parsed from %s", userAgent)
+	}
+}
+
+func TestParseTruncatesVersion(t *testing.T) {
+	client := Parse("Mozilla/5.0 (X11; Linux x86_64) Firefox/" + strings.Repeat("1.", 100))
+
+	assert.Equal(t, "Firefox", client.Browser, "Browser has to be parsed")
+	assert.Len(t, client.Version, maxVersionLength, "Version has to be cut to its column size")
+}
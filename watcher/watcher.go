@@ -0,0 +1,105 @@
+package watcher
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Watcher calls its reload function when any of its files changes. The files
+// are polled from a goroutine of its own, so that reading them never happens
+// while serving a request. A failed reload is retried at the next poll, the
+// previous content staying in use meanwhile.
+type Watcher struct {
+	sync.Mutex
+	logger   *zap.SugaredLogger
+	name     string
+	paths    []string
+	reload   func() error
+	modTimes []time.Time
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// New polls paths every period, taking them as loaded at the time of the
+// call. name tells the files apart in the logs.
+func New(name string, paths []string, period time.Duration, reload func() error, logger *zap.SugaredLogger) *Watcher {
+	w := &Watcher{
+		logger: logger,
+		name:   name,
+		paths:  paths,
+		reload: reload,
+		done:   make(chan struct{}),
+	}
+
+	w.modTimes, _ = w.stat()
+	go w.run(period)
+
+	return w
+}
+
+func (w *Watcher) run(period time.Duration) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+			w.Check()
+		}
+	}
+}
+
+func (w *Watcher) stat() ([]time.Time, error) {
+	modTimes := make([]time.Time, len(w.paths))
+	for i, path := range w.paths {
+		info, err := os.Stat(path)
+		if err != nil {
+
+			return nil, err
+		}
+
+		modTimes[i] = info.ModTime()
+	}
+
+	return modTimes, nil
+}
+
+// Check reloads the files now if any of them changed since the last load.
+func (w *Watcher) Check() {
+	w.Lock()
+	defer w.Unlock()
+
+	modTimes, err := w.stat()
+	if err != nil {
+		w.logger.Errorf("Checking %s went in error: %s", w.name, err.Error())
+		return
+	}
+
+	changed := len(modTimes) != len(w.modTimes)
+	for i := 0; !changed && i < len(modTimes); i++ {
+		changed = !modTimes[i].Equal(w.modTimes[i])
+	}
+
+	if !changed {
+		return
+	}
+
+	if err := w.reload(); err != nil {
+		w.logger.Errorf("Reloading %s went in error, keeping the previous one: %s", w.name, err.Error())
+		return
+	}
+
+	w.modTimes = modTimes
+}
+
+// Stop ends the polling.
+func (w *Watcher) Stop() {
+	w.stopOnce.Do(func() {
+		close(w.done)
+	})
+}
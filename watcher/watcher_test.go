@@ -0,0 +1,68 @@
+package watcher
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestCheck(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file")
+	os.WriteFile(path, []byte("first"), 0o644)
+
+	reloads := 0
+	var reloadErr error
+	w := New("test file", []string{path}, time.Hour, func() error {
+		reloads++
+		return reloadErr
+	}, zap.NewNop().Sugar())
+	defer w.Stop()
+
+	w.Check()
+	assert.Equal(t, 0, reloads, "Unchanged files must not be reloaded")
+
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(path, later, later)
+	reloadErr = errors.New("broken")
+	w.Check()
+	w.Check()
+	assert.Equal(t, 2, reloads, "Failed reloads have to be retried")
+
+	reloadErr = nil
+	w.Check()
+	w.Check()
+	assert.Equal(t, 3, reloads, "Reloaded files must not be reloaded again until they change")
+
+	os.Remove(path)
+	w.Check()
+	assert.Equal(t, 3, reloads, "Missing files must not be reloaded")
+}
+
+func TestPolling(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file")
+	os.WriteFile(path, []byte("first"), 0o644)
+
+	reloaded := make(chan struct{}, 1)
+	w := New("test file", []string{path}, 10*time.Millisecond, func() error {
+		select {
+		case reloaded <- struct{}{}:
+		default:
+		}
+		return nil
+	}, zap.NewNop().Sugar())
+	defer w.Stop()
+
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(path, later, later)
+
+	select {
+	case <-reloaded:
+	case <-time.After(time.Second):
+		t.Fatal("Changed file has to be reloaded by the polling")
+	}
+}